@@ -0,0 +1,87 @@
+// Package bot picks moves for computer players. Like the rules package it is
+// network-free, a bot only looks at the rules.State of the game.
+//
+// Rolling is never a choice in yutnori, so a bot only decides which legal
+// move to make. Three difficulties are available: Easy picks a random legal
+// move, Medium takes the move that looks best right away, favouring captures
+// and finishing pieces, and Hard searches a few moves ahead weighing every
+// roll by its probability.
+package bot
+
+import (
+	"math/rand"
+
+	"github.com/AdventurerAmer/yutnori/rules"
+)
+
+type Difficulty string
+
+const (
+	Easy   Difficulty = "easy"
+	Medium Difficulty = "medium"
+	Hard   Difficulty = "hard"
+)
+
+// HardDepth is how many rolls and moves the Hard bot looks ahead.
+const HardDepth = 4
+
+// Strategy picks the move of the current player, s is in the selecting move
+// phase and is left untouched.
+type Strategy interface {
+	ChooseMove(s *rules.State) rules.Move
+}
+
+// New returns the strategy of a difficulty, an unknown difficulty is Medium.
+// rng is only used by Easy and model only by Hard.
+func New(d Difficulty, model rules.ThrowModel, rng *rand.Rand) Strategy {
+	switch d {
+	case Easy:
+		return Random{Rand: rng}
+	case Hard:
+		return Lookahead{Model: model, Depth: HardDepth}
+	}
+	return Greedy{}
+}
+
+// ParseDifficulty reports whether d names a difficulty.
+func ParseDifficulty(d string) (Difficulty, bool) {
+	switch Difficulty(d) {
+	case Easy, Medium, Hard:
+		return Difficulty(d), true
+	}
+	return Medium, false
+}
+
+type Random struct {
+	Rand *rand.Rand
+}
+
+func (r Random) ChooseMove(s *rules.State) rules.Move {
+	moves := s.LegalMoves()
+	return moves[r.Rand.Intn(len(moves))]
+}
+
+type Greedy struct {
+}
+
+func (g Greedy) ChooseMove(s *rules.State) rules.Move {
+	team := s.Players[s.Turn].Team
+	moves := s.LegalMoves()
+	best, bestScore := moves[0], 0.0
+	for idx, m := range moves {
+		child := s.Clone()
+		_, err := child.ApplyMove(m)
+		if err != nil {
+			continue
+		}
+		score := Evaluate(child, team)
+		// a capture that earns a bonus throw keeps the turn
+		if child.Phase == rules.PhaseCanRoll && child.Turn == s.Turn {
+			score += BonusThrowValue
+		}
+		if idx == 0 || score > bestScore {
+			best, bestScore = m, score
+		}
+	}
+	return best
+}
@@ -0,0 +1,192 @@
+package bot
+
+import (
+	"errors"
+	"math"
+	"math/rand"
+	"reflect"
+	"slices"
+	"testing"
+
+	"github.com/AdventurerAmer/yutnori/rules"
+)
+
+func newGame(t *testing.T, playerCount int) *rules.State {
+	t.Helper()
+	s := rules.NewState(playerCount, 4)
+	_, err := s.Start(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func TestNew(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	tests := []struct {
+		d    string
+		ok   bool
+		want Strategy
+	}{
+		{"easy", true, Random{Rand: rng}},
+		{"medium", true, Greedy{}},
+		{"hard", true, Lookahead{Model: rules.DefaultThrowModel, Depth: HardDepth}},
+		{"impossible", false, Greedy{}},
+	}
+	for _, test := range tests {
+		d, ok := ParseDifficulty(test.d)
+		if ok != test.ok {
+			t.Errorf("%s: got %v", test.d, ok)
+		}
+		if got := New(d, rules.DefaultThrowModel, rng); got != test.want {
+			t.Errorf("%s: got %T", test.d, got)
+		}
+	}
+}
+
+func TestPlay(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	for _, d := range []Difficulty{Easy, Medium, Hard} {
+		strategy := New(d, rules.DefaultThrowModel, rng)
+		for _, playerCount := range []int{2, 3} {
+			s := newGame(t, playerCount)
+			strategies := make([]Strategy, playerCount)
+			for idx := range strategies {
+				strategies[idx] = strategy
+			}
+			// Play fails on the first move the rules engine refuses
+			err := Play(s, strategies, rules.DefaultThrowModel, rng)
+			if err != nil {
+				t.Fatalf("%s: %v", d, err)
+			}
+			if s.WinningTeam == -1 {
+				t.Errorf("%s: the game ended without a winner", d)
+			}
+		}
+	}
+}
+
+func TestChooseMove(t *testing.T) {
+	rng := rand.New(rand.NewSource(2))
+	for _, d := range []Difficulty{Easy, Medium, Hard} {
+		strategy := New(d, rules.DefaultThrowModel, rng)
+		for _, playerCount := range []int{2, 3} {
+			s := newGame(t, playerCount)
+			for s.Phase != rules.PhaseGameEnded {
+				var err error
+				if s.Phase == rules.PhaseCanRoll {
+					_, err = s.ApplyRoll(rules.DefaultThrowModel.Throw(rng).Roll)
+				} else {
+					before := s.Clone()
+					m := strategy.ChooseMove(s)
+					if !slices.Contains(s.LegalMoves(), m) {
+						t.Fatalf("%s: chose an illegal move %+v", d, m)
+					}
+					if s.Turn != before.Turn || !slices.Equal(s.Rolls, before.Rolls) {
+						t.Fatalf("%s: choosing a move changed the state", d)
+					}
+					_, err = s.ApplyMove(m)
+				}
+				if err != nil {
+					t.Fatalf("%s: %v", d, err)
+				}
+			}
+		}
+	}
+}
+
+func TestStomp(t *testing.T) {
+	for _, strategy := range []Strategy{Greedy{}, Lookahead{Model: rules.DefaultThrowModel, Depth: HardDepth}} {
+		s := newGame(t, 2)
+		s.Teams[1].Pieces[0] = rules.Piece{Cell: rules.Right2}
+		s.Phase = rules.PhaseSelectingMove
+		s.Rolls = []int{rules.Do, rules.Geol}
+		m := strategy.ChooseMove(s)
+		events, err := s.ApplyMove(m)
+		if err != nil {
+			t.Fatal(err)
+		}
+		stomped := slices.ContainsFunc(events, func(e rules.Event) bool {
+			_, ok := e.(rules.StompEvent)
+			return ok
+		})
+		if !stomped {
+			t.Errorf("%T: got move %+v want a stomp", strategy, m)
+		}
+	}
+}
+
+func TestGreedyBeatsRandom(t *testing.T) {
+	rng := rand.New(rand.NewSource(2))
+	wins := 0
+	for game := range 100 {
+		s := rules.NewState(2, 4)
+		_, err := s.Start(game % 2)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = Play(s, []Strategy{Greedy{}, Random{Rand: rng}}, rules.DefaultThrowModel, rng)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if s.WinningTeam == 0 {
+			wins++
+		}
+	}
+	if wins < 60 {
+		t.Errorf("greedy won %d of 100 games", wins)
+	}
+}
+
+func TestWinProbabilities(t *testing.T) {
+	rng := rand.New(rand.NewSource(3))
+	_, err := WinProbabilities(rules.NewState(2, 4), 10, rules.DefaultThrowModel, rng)
+	if !errors.Is(err, ErrNotStarted) {
+		t.Errorf("got %v want %v", err, ErrNotStarted)
+	}
+
+	s := newGame(t, 3)
+	before := s.Clone()
+	probabilities, err := WinProbabilities(s, 200, rules.DefaultThrowModel, rng)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(s, before) {
+		t.Error("the state changed")
+	}
+	total := 0.0
+	for _, p := range probabilities {
+		total += p
+	}
+	if len(probabilities) != 3 || math.Abs(total-1) > 1e-9 {
+		t.Errorf("got %v", probabilities)
+	}
+
+	// a team one move away from winning is the favourite
+	s = newGame(t, 2)
+	for idx := range s.Teams[1].Pieces {
+		s.Teams[1].Pieces[idx] = rules.Piece{Cell: rules.BottomRightCorner, IsFinished: true}
+	}
+	s.Teams[1].Pieces[0] = rules.Piece{Cell: rules.Bottom3}
+	probabilities, err = WinProbabilities(s, 200, rules.DefaultThrowModel, rng)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if probabilities[1] < 0.8 {
+		t.Errorf("got %v", probabilities)
+	}
+
+	err = Play(s, []Strategy{Greedy{}, Greedy{}}, rules.DefaultThrowModel, rng)
+	if err != nil {
+		t.Fatal(err)
+	}
+	probabilities, err = WinProbabilities(s, 200, rules.DefaultThrowModel, rng)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []float64{0, 0}
+	want[s.WinningTeam] = 1
+	if !slices.Equal(probabilities, want) {
+		t.Errorf("got %v want %v", probabilities, want)
+	}
+}
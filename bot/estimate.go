@@ -0,0 +1,45 @@
+package bot
+
+import (
+	"errors"
+	"math/rand"
+
+	"github.com/AdventurerAmer/yutnori/rules"
+)
+
+// EstimatePlayouts is the number of playouts behind an estimate, the
+// estimates are within about 3% of the true probabilities.
+const EstimatePlayouts = 1000
+
+var ErrNotStarted = errors.New("game has not started")
+
+// WinProbabilities estimates the chance of every team to win s, indexed by
+// team. s is played out playouts times with Medium bots for every player and
+// is left untouched. The winner of an ended game is certain.
+func WinProbabilities(s *rules.State, playouts int, model rules.ThrowModel, rng *rand.Rand) ([]float64, error) {
+	probabilities := make([]float64, len(s.Teams))
+	if s.WinningTeam != -1 {
+		probabilities[s.WinningTeam] = 1
+		return probabilities, nil
+	}
+	if s.Phase == rules.PhaseGameEnded {
+		return nil, ErrNotStarted
+	}
+	strategies := make([]Strategy, len(s.Players))
+	for idx := range strategies {
+		strategies[idx] = Greedy{}
+	}
+	playouts = max(playouts, 1)
+	for range playouts {
+		playout := s.Clone()
+		err := Play(playout, strategies, model, rng)
+		if err != nil {
+			return nil, err
+		}
+		probabilities[playout.WinningTeam]++
+	}
+	for team := range probabilities {
+		probabilities[team] /= float64(playouts)
+	}
+	return probabilities, nil
+}
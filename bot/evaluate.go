@@ -0,0 +1,105 @@
+package bot
+
+import (
+	"slices"
+
+	"github.com/AdventurerAmer/yutnori/rules"
+)
+
+const (
+	// FinishedValue is added for every finished piece on top of its progress.
+	FinishedValue = 4.0
+	// BonusThrowValue is roughly what an extra throw is worth in progress.
+	BonusThrowValue = 3.0
+	// WinValue is the score of a won game, far above any progress.
+	WinValue = 1000.0
+)
+
+// cellDistance is the shortest number of steps from a cell back to the
+// bottom right corner, taking every shortcut a piece can land on.
+var cellDistance = [rules.CellCount]int{
+	rules.BottomRightCorner: 0,
+	rules.Right0:            10,
+	rules.Right1:            9,
+	rules.Right2:            8,
+	rules.Right3:            7,
+	rules.TopRightCorner:    6,
+	rules.Top0:              10,
+	rules.Top1:              9,
+	rules.Top2:              8,
+	rules.Top3:              7,
+	rules.TopLeftCorner:     6,
+	rules.Left0:             9,
+	rules.Left1:             8,
+	rules.Left2:             7,
+	rules.Left3:             6,
+	rules.BottomLeftCorner:  5,
+	rules.Bottom0:           4,
+	rules.Bottom1:           3,
+	rules.Bottom2:           2,
+	rules.Bottom3:           1,
+	rules.MainDiagonal0:     5,
+	rules.MainDiagonal1:     4,
+	rules.MainDiagonal2:     2,
+	rules.MainDiagonal3:     1,
+	rules.AntiDiagonal0:     5,
+	rules.AntiDiagonal1:     4,
+	rules.AntiDiagonal2:     7,
+	rules.AntiDiagonal3:     6,
+	rules.Center:            3,
+}
+
+// startDistance is the number of steps a piece at the start needs to finish,
+// one past the corner it comes back to.
+const startDistance = 12
+
+// Remaining is the number of steps the piece needs to finish.
+func Remaining(p rules.Piece) int {
+	switch {
+	case p.IsFinished:
+		return 0
+	case p.IsAtStart:
+		return startDistance
+	}
+	return cellDistance[p.Cell] + 1
+}
+
+// Progress sums how far the pieces of the team went.
+func Progress(s *rules.State, team int) float64 {
+	progress := 0.0
+	for _, p := range s.Teams[team].Pieces[:s.PieceCount] {
+		progress += float64(startDistance - Remaining(p))
+		if p.IsFinished {
+			progress += FinishedValue
+		}
+	}
+	return progress
+}
+
+// Evaluate scores s for the team, higher is better. A finished game scores
+// by place, otherwise the team's progress is compared with the best of the
+// teams still playing.
+func Evaluate(s *rules.State, team int) float64 {
+	if s.Phase == rules.PhaseGameEnded {
+		place := slices.Index(s.Ranking, team)
+		switch {
+		case place == -1:
+			return -WinValue
+		case len(s.Ranking) == 1:
+			return WinValue
+		}
+		return WinValue - 2*WinValue*float64(place)/float64(len(s.Ranking)-1)
+	}
+	best, opponents := 0.0, 0
+	for opponent := range s.Teams {
+		if opponent == team || s.IsTeamOut(opponent) {
+			continue
+		}
+		progress := Progress(s, opponent)
+		if opponents == 0 || progress > best {
+			best = progress
+		}
+		opponents++
+	}
+	return Progress(s, team) - best
+}
@@ -0,0 +1,73 @@
+package bot
+
+import (
+	"math"
+
+	"github.com/AdventurerAmer/yutnori/rules"
+)
+
+// Lookahead is an expectimax search. Rolls are averaged by their probability
+// under Model, the bot's team takes its best move and the other teams are
+// assumed to take the move that hurts it the most. Every roll and every move
+// counts towards Depth.
+type Lookahead struct {
+	Model rules.ThrowModel
+	Depth int
+}
+
+func (l Lookahead) ChooseMove(s *rules.State) rules.Move {
+	team := s.Players[s.Turn].Team
+	probs := l.Model.RollProbabilities()
+	moves := s.LegalMoves()
+	best, bestScore := moves[0], math.Inf(-1)
+	for _, m := range moves {
+		child := s.Clone()
+		_, err := child.ApplyMove(m)
+		if err != nil {
+			continue
+		}
+		score := l.value(child, team, l.Depth-1, &probs)
+		if score > bestScore {
+			best, bestScore = m, score
+		}
+	}
+	return best
+}
+
+func (l Lookahead) value(s *rules.State, team int, depth int, probs *[rules.Mo - rules.Backdo + 1]float64) float64 {
+	if depth <= 0 || s.Phase == rules.PhaseGameEnded {
+		return Evaluate(s, team)
+	}
+	if s.Phase == rules.PhaseCanRoll {
+		expected := 0.0
+		for idx, p := range probs {
+			if p == 0 {
+				continue
+			}
+			child := s.Clone()
+			_, err := child.ApplyRoll(idx + rules.Backdo)
+			if err != nil {
+				continue
+			}
+			expected += p * l.value(child, team, depth-1, probs)
+		}
+		return expected
+	}
+	maximize := s.Players[s.Turn].Team == team
+	best := math.Inf(1)
+	if maximize {
+		best = math.Inf(-1)
+	}
+	for _, m := range s.LegalMoves() {
+		child := s.Clone()
+		_, err := child.ApplyMove(m)
+		if err != nil {
+			continue
+		}
+		v := l.value(child, team, depth-1, probs)
+		if (maximize && v > best) || (!maximize && v < best) {
+			best = v
+		}
+	}
+	return best
+}
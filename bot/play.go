@@ -0,0 +1,34 @@
+package bot
+
+import (
+	"errors"
+	"math/rand"
+
+	"github.com/AdventurerAmer/yutnori/rules"
+)
+
+// MaxPlayoutSteps bounds Play, no real game comes close to it.
+const MaxPlayoutSteps = 100000
+
+var ErrPlayoutTooLong = errors.New("playout did not end")
+
+// Play plays s to its end. Rolls are thrown with model and rng, and every
+// move is selected by the strategy of the player whose turn it is.
+func Play(s *rules.State, strategies []Strategy, model rules.ThrowModel, rng *rand.Rand) error {
+	for step := 0; s.Phase != rules.PhaseGameEnded; step++ {
+		if step == MaxPlayoutSteps {
+			return ErrPlayoutTooLong
+		}
+		var err error
+		switch s.Phase {
+		case rules.PhaseCanRoll:
+			_, err = s.ApplyRoll(model.Throw(rng).Roll)
+		case rules.PhaseSelectingMove:
+			_, err = s.ApplyMove(strategies[s.Turn].ChooseMove(s))
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
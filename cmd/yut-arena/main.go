@@ -0,0 +1,263 @@
+// Command yut-arena plays bots against each other without a server and
+// reports their win rates, to tune bots and compare rule variants.
+package main
+
+import (
+	"cmp"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"math"
+	"math/rand"
+	"os"
+	"runtime"
+	"slices"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"github.com/AdventurerAmer/yutnori/bot"
+	"github.com/AdventurerAmer/yutnori/rules"
+)
+
+const MinTableSize = 2
+const MaxTableSize = 6
+
+// z is the normal quantile of the reported 95% confidence intervals.
+const z = 1.96
+
+type Entrant struct {
+	Name       string
+	Difficulty bot.Difficulty
+	Games      int
+	Wins       int
+	Byes       int
+	Met        map[int]int // games played against each other entrant
+}
+
+type Config struct {
+	TableSize  int
+	Games      int // per table
+	PieceCount int
+	Rules      rules.RuleSet
+	ThrowModel rules.ThrowModel
+	Seed       int64
+	Workers    int
+}
+
+// parseEntrants reads a comma separated list of difficulties, an entry can
+// be named with name=difficulty.
+func parseEntrants(list string) ([]Entrant, error) {
+	entrants := []Entrant{}
+	names := map[string]int{}
+	for _, entry := range strings.Split(list, ",") {
+		name, difficulty, named := strings.Cut(strings.TrimSpace(entry), "=")
+		if !named {
+			difficulty = name
+		}
+		d, ok := bot.ParseDifficulty(difficulty)
+		if !ok {
+			return nil, fmt.Errorf("unknown difficulty '%s'", difficulty)
+		}
+		names[name]++
+		if names[name] > 1 {
+			name = fmt.Sprintf("%s#%d", name, names[name])
+		}
+		entrants = append(entrants, Entrant{Name: name, Difficulty: d, Met: make(map[int]int)})
+	}
+	return entrants, nil
+}
+
+// playGame returns the seat of the winner.
+func playGame(cfg Config, entrants []Entrant, seats []int, seed int64) (int, error) {
+	rng := rand.New(rand.NewSource(seed))
+	s := rules.NewState(len(seats), cfg.PieceCount)
+	s.Rules = cfg.Rules
+	strategies := make([]bot.Strategy, len(seats))
+	for idx, e := range seats {
+		strategies[idx] = bot.New(entrants[e].Difficulty, cfg.ThrowModel, rng)
+	}
+	_, err := s.Start(rng.Intn(len(seats)))
+	if err != nil {
+		return 0, err
+	}
+	err = bot.Play(s, strategies, cfg.ThrowModel, rng)
+	if err != nil {
+		return 0, err
+	}
+	return s.WinningTeam, nil
+}
+
+// playTables plays cfg.Games games at every table, the seats rotate between
+// games. Game i is seeded with seed+i so results do not depend on the number
+// of workers.
+func playTables(cfg Config, entrants []Entrant, tables [][]int, seed int64) error {
+	type game struct {
+		seats  []int
+		seed   int64
+		winner int
+		err    error
+	}
+	games := make(chan game)
+	results := make(chan game)
+	var wg sync.WaitGroup
+	for range cfg.Workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for g := range games {
+				g.winner, g.err = playGame(cfg, entrants, g.seats, g.seed)
+				results <- g
+			}
+		}()
+	}
+	go func() {
+		idx := int64(0)
+		for _, table := range tables {
+			for g := range cfg.Games {
+				seats := make([]int, len(table))
+				for seat := range seats {
+					seats[seat] = table[(seat+g)%len(table)]
+				}
+				games <- game{seats: seats, seed: seed + idx}
+				idx++
+			}
+		}
+		close(games)
+		wg.Wait()
+		close(results)
+	}()
+
+	var errs []error
+	for g := range results {
+		if g.err != nil {
+			errs = append(errs, fmt.Errorf("game seeded %d: %w", g.seed, g.err))
+			continue
+		}
+		entrants[g.seats[g.winner]].Wins++
+		for _, a := range g.seats {
+			entrants[a].Games++
+			for _, b := range g.seats {
+				if a != b {
+					entrants[a].Met[b]++
+				}
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// wilson is the Wilson score interval of a win rate.
+func wilson(wins, games int) (float64, float64) {
+	if games == 0 {
+		return 0, 1
+	}
+	n := float64(games)
+	p := float64(wins) / n
+	denom := 1 + z*z/n
+	center := (p + z*z/(2*n)) / denom
+	half := z * math.Sqrt(p*(1-p)/n+z*z/(4*n*n)) / denom
+	return max(center-half, 0), min(center+half, 1)
+}
+
+func report(entrants []Entrant, cfg Config) {
+	order := make([]int, len(entrants))
+	for idx := range order {
+		order[idx] = idx
+	}
+	rate := func(e Entrant) float64 {
+		if e.Games == 0 {
+			return 0
+		}
+		return float64(e.Wins) / float64(e.Games)
+	}
+	slices.SortStableFunc(order, func(a, b int) int {
+		return cmp.Compare(rate(entrants[b]), rate(entrants[a]))
+	})
+	fmt.Printf("%d-player tables, a seat wins %.1f%% of the games by chance\n", cfg.TableSize, 100/float64(cfg.TableSize))
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "bot\tdifficulty\tgames\twins\twin rate\t95% interval")
+	for _, idx := range order {
+		e := entrants[idx]
+		low, high := wilson(e.Wins, e.Games)
+		fmt.Fprintf(w, "%s\t%s\t%d\t%d\t%.1f%%\t%.1f%% - %.1f%%\n", e.Name, e.Difficulty, e.Games, e.Wins, 100*rate(e), 100*low, 100*high)
+	}
+	w.Flush()
+}
+
+func main() {
+	log.SetFlags(0)
+	bots := flag.String("bots", "easy,medium,hard", "comma separated difficulties of the bots, name=difficulty names a bot")
+	format := flag.String("format", "round-robin", "pairings, round-robin or swiss")
+	rounds := flag.Int("rounds", 5, "number of swiss rounds")
+	rulesJSON := flag.String("rules", "", "house rules as JSON, e.g. {\"no_stacking\": true}")
+	modelJSON := flag.String("throw-model", "", "throw model as JSON, e.g. {\"flat_probabilities\": [0.5, 0.5, 0.5, 0.5]}")
+	cfg := Config{ThrowModel: rules.DefaultThrowModel}
+	flag.IntVar(&cfg.TableSize, "table", 2, "players per table, 2 to 6")
+	flag.IntVar(&cfg.Games, "games", 1000, "games played at every table")
+	flag.IntVar(&cfg.PieceCount, "pieces", 4, "pieces per player")
+	flag.Int64Var(&cfg.Seed, "seed", 0, "seed of the first game, 0 picks one")
+	flag.IntVar(&cfg.Workers, "workers", runtime.NumCPU(), "games played in parallel")
+	flag.Parse()
+
+	entrants, err := parseEntrants(*bots)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if cfg.TableSize < MinTableSize || cfg.TableSize > MaxTableSize {
+		log.Fatalf("table size must be between %d and %d", MinTableSize, MaxTableSize)
+	}
+	if len(entrants) < cfg.TableSize {
+		log.Fatalf("%d bots cannot fill a %d-player table", len(entrants), cfg.TableSize)
+	}
+	if cfg.PieceCount < rules.MinPieceCount || cfg.PieceCount > rules.MaxPieceCount {
+		log.Fatalf("piece count must be between %d and %d", rules.MinPieceCount, rules.MaxPieceCount)
+	}
+	if *rulesJSON != "" {
+		err = json.Unmarshal([]byte(*rulesJSON), &cfg.Rules)
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+	if *modelJSON != "" {
+		err = json.Unmarshal([]byte(*modelJSON), &cfg.ThrowModel)
+		if err != nil {
+			log.Fatal(err)
+		}
+		cfg.ThrowModel = cfg.ThrowModel.Clamped()
+	}
+	if cfg.Seed == 0 {
+		cfg.Seed = time.Now().UnixNano()
+	}
+	cfg.Workers = max(cfg.Workers, 1)
+	fmt.Printf("seed %d\n", cfg.Seed)
+
+	start := time.Now()
+	switch *format {
+	case "round-robin":
+		tables := roundRobinTables(len(entrants), cfg.TableSize)
+		err = playTables(cfg, entrants, tables, cfg.Seed)
+	case "swiss":
+		rng := rand.New(rand.NewSource(cfg.Seed))
+		seed := cfg.Seed
+		for round := range *rounds {
+			tables := swissTables(entrants, cfg.TableSize, rng)
+			err = playTables(cfg, entrants, tables, seed)
+			if err != nil {
+				break
+			}
+			seed += int64(len(tables) * cfg.Games)
+			fmt.Printf("round %d: %d tables\n", round+1, len(tables))
+		}
+	default:
+		log.Fatalf("unknown format '%s'", *format)
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+	report(entrants, cfg)
+	fmt.Printf("played in %v\n", time.Since(start).Round(time.Millisecond))
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"math/rand"
+	"slices"
+	"testing"
+
+	"github.com/AdventurerAmer/yutnori/bot"
+	"github.com/AdventurerAmer/yutnori/rules"
+)
+
+func TestParseEntrants(t *testing.T) {
+	entrants, err := parseEntrants("easy, fast=hard,hard,hard")
+	if err != nil {
+		t.Fatal(err)
+	}
+	names := []string{}
+	for _, e := range entrants {
+		names = append(names, e.Name)
+	}
+	if !slices.Equal(names, []string{"easy", "fast", "hard", "hard#2"}) || entrants[1].Difficulty != bot.Hard {
+		t.Errorf("got %+v", entrants)
+	}
+	_, err = parseEntrants("easy,impossible")
+	if err == nil {
+		t.Error("parsed an unknown difficulty")
+	}
+}
+
+func TestPlayTables(t *testing.T) {
+	entrants, err := parseEntrants("easy,medium,hard")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg := Config{TableSize: 2, Games: 4, PieceCount: 4, ThrowModel: rules.DefaultThrowModel, Workers: 2}
+	err = playTables(cfg, entrants, roundRobinTables(len(entrants), cfg.TableSize), 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wins := 0
+	for _, e := range entrants {
+		wins += e.Wins
+		if e.Games != 8 || e.Met[0]+e.Met[1]+e.Met[2] != 8 {
+			t.Errorf("got %+v", e)
+		}
+	}
+	if wins != 12 {
+		t.Errorf("got %d wins over 12 games", wins)
+	}
+}
+
+func TestRoundRobinTables(t *testing.T) {
+	tables := roundRobinTables(4, 3)
+	want := [][]int{{0, 1, 2}, {0, 1, 3}, {0, 2, 3}, {1, 2, 3}}
+	if !slices.EqualFunc(tables, want, slices.Equal) {
+		t.Errorf("got %v want %v", tables, want)
+	}
+}
+
+func TestSwissTables(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	entrants := make([]Entrant, 5)
+	for idx := range entrants {
+		entrants[idx] = Entrant{Games: 4, Wins: 4 - idx, Met: map[int]int{}}
+	}
+	// the first and the second met, the first plays the third instead
+	entrants[0].Met[1], entrants[1].Met[0] = 3, 3
+	tables := swissTables(entrants, 2, rng)
+	want := [][]int{{0, 2}, {1, 3}}
+	if !slices.EqualFunc(tables, want, slices.Equal) {
+		t.Errorf("got %v want %v", tables, want)
+	}
+	if entrants[4].Byes != 1 {
+		t.Errorf("the lowest ranked entrant got %d byes", entrants[4].Byes)
+	}
+
+	// the bye goes to the entrant that had the fewest
+	tables = swissTables(entrants, 2, rng)
+	if entrants[3].Byes != 1 || entrants[4].Byes != 1 || slices.ContainsFunc(tables, func(table []int) bool {
+		return slices.Contains(table, 3)
+	}) {
+		t.Errorf("got %v", tables)
+	}
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"cmp"
+	"math/rand"
+	"slices"
+)
+
+// roundRobinTables seats every combination of size entrants once.
+func roundRobinTables(count int, size int) [][]int {
+	tables := [][]int{}
+	table := []int{}
+	var seat func(next int)
+	seat = func(next int) {
+		if len(table) == size {
+			tables = append(tables, slices.Clone(table))
+			return
+		}
+		for e := next; e <= count-(size-len(table)); e++ {
+			table = append(table, e)
+			seat(e + 1)
+			table = table[:len(table)-1]
+		}
+	}
+	seat(0)
+	return tables
+}
+
+// swissTables seats entrants with similar win rates together. The entrants
+// that do not fill a table sit the round out, picked among the lowest ranked
+// with the fewest byes. A table is filled with the highest ranked entrants
+// that met its players the least.
+func swissTables(entrants []Entrant, size int, rng *rand.Rand) [][]int {
+	rate := func(e Entrant) float64 {
+		if e.Games == 0 {
+			return 0
+		}
+		return float64(e.Wins) / float64(e.Games)
+	}
+	order := rng.Perm(len(entrants)) // breaks ties at random
+	slices.SortStableFunc(order, func(a, b int) int {
+		return cmp.Compare(rate(entrants[b]), rate(entrants[a]))
+	})
+
+	byeCount := len(order) % size
+	byes := slices.Clone(order)
+	slices.Reverse(byes)
+	slices.SortStableFunc(byes, func(a, b int) int {
+		return cmp.Compare(entrants[a].Byes, entrants[b].Byes)
+	})
+	for _, e := range byes[:byeCount] {
+		entrants[e].Byes++
+		order = slices.DeleteFunc(order, func(o int) bool {
+			return o == e
+		})
+	}
+
+	tables := [][]int{}
+	for len(order) != 0 {
+		table := []int{order[0]}
+		order = order[1:]
+		for len(table) < size {
+			best, bestMet := 0, -1
+			for idx, e := range order {
+				met := 0
+				for _, t := range table {
+					met += entrants[e].Met[t]
+				}
+				if bestMet == -1 || met < bestMet {
+					best, bestMet = idx, met
+				}
+			}
+			table = append(table, order[best])
+			order = slices.Delete(order, best, best+1)
+		}
+		tables = append(tables, table)
+	}
+	return tables
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/AdventurerAmer/yutnori/bot"
+	"github.com/AdventurerAmer/yutnori/notation"
+	"github.com/AdventurerAmer/yutnori/replay"
+)
+
+func load(path string) (*replay.Replay, error) {
+	if filepath.Ext(path) != ".yut" {
+		return replay.Load(path)
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return notation.Import(f)
+}
+
+// estimate prints the win probability of every team after each move, the
+// playouts are seeded with the seed of the game so the output is the same on
+// every run.
+func estimate(r *replay.Replay, playouts int) error {
+	s, err := r.NewState()
+	if err != nil {
+		return err
+	}
+	names := make([]string, len(s.Teams))
+	for _, p := range r.Players {
+		if names[p.Team] != "" {
+			names[p.Team] += "+"
+		}
+		names[p.Team] += p.Name
+	}
+	rng := rand.New(rand.NewSource(r.Seed))
+	for idx, e := range r.Events {
+		// moves and skips are made by the player whose turn it is, whatever
+		// the log says
+		player := s.Turn
+		if e.Kind == replay.EventForfeit {
+			player = e.Player
+		}
+		_, err = replay.Apply(s, e)
+		if err != nil {
+			return fmt.Errorf("event %d (%s): %w", idx, e.Kind, err)
+		}
+		if e.Kind != replay.EventMove && e.Kind != replay.EventSkip && e.Kind != replay.EventForfeit {
+			continue
+		}
+		probabilities, err := bot.WinProbabilities(s, playouts, r.Settings.ThrowModel, rng)
+		if err != nil {
+			return err
+		}
+		line := []string{}
+		for team, p := range probabilities {
+			line = append(line, fmt.Sprintf("%s %.1f%%", names[team], 100*p))
+		}
+		fmt.Printf("%d %s by %s: %s\n", idx, e.Kind, r.Players[player].Name, strings.Join(line, ", "))
+	}
+	return nil
+}
+
+func main() {
+	log.SetFlags(0)
+	export := flag.Bool("export", false, "print the games in text notation instead of verifying them")
+	estimates := flag.Bool("estimate", false, "print the win probability of every team after each move instead of verifying the games")
+	playouts := flag.Int("playouts", bot.EstimatePlayouts, "playouts behind every estimate")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "usage: %s [-export|-estimate] game.json|game.yut...\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() == 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	failed := false
+	for _, path := range flag.Args() {
+		r, err := load(path)
+		if err == nil && *export {
+			err = notation.Export(os.Stdout, r)
+		} else if err == nil && *estimates {
+			err = estimate(r, *playouts)
+		} else if err == nil {
+			err = r.Verify()
+		}
+		if err != nil {
+			log.Printf("%s: %s\n", path, err)
+			failed = true
+			continue
+		}
+		if !*export && !*estimates {
+			fmt.Printf("%s: ok, %d players, %d events, winning team %d\n", path, len(r.Players), len(r.Events), r.Final.WinningTeam)
+		}
+	}
+	if failed {
+		os.Exit(1)
+	}
+}
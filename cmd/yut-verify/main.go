@@ -0,0 +1,41 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/AdventurerAmer/yutnori/fair"
+)
+
+func main() {
+	log.SetFlags(0)
+
+	logPath := flag.String("log", "", "path of the revealed game log (json)")
+	commitment := flag.String("commitment", "", "seed commitment received when the game started")
+	flag.Parse()
+	if *logPath == "" {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	b, err := os.ReadFile(*logPath)
+	if err != nil {
+		log.Fatal(err)
+	}
+	var l fair.Log
+	err = json.Unmarshal(b, &l)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if *commitment != "" && *commitment != l.Commitment {
+		log.Fatalf("commitment of the log '%s' is not the one received '%s'", l.Commitment, *commitment)
+	}
+	err = fair.Verify(l)
+	if err != nil {
+		log.Fatal(err)
+	}
+	fmt.Printf("ok: %d rolls verified\n", len(l.Rolls))
+}
@@ -0,0 +1,98 @@
+// Package fair implements the commit-reveal scheme that lets players verify
+// the rolls of a finished game.
+//
+// The server draws a secret seed and publishes its SHA-256 commitment when
+// the game starts. The starting player is drawn from StartSeed, players may
+// then contribute entropy until the first throw, and every throw is drawn
+// from GameSeed. Once the game is over the server reveals its seed so
+// anyone can recompute both random sources and compare them to the game.
+package fair
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	mathrand "math/rand"
+
+	"github.com/AdventurerAmer/yutnori/rules"
+)
+
+const ServerSeedSize = 32
+const MaxContributionLength = 64
+
+type Roll struct {
+	Roll   int                    `json:"roll"`
+	Sticks [rules.StickCount]bool `json:"sticks"`
+}
+
+type Log struct {
+	Commitment     string           `json:"commitment"`
+	ServerSeed     string           `json:"server_seed"`
+	Contributions  []string         `json:"contributions"`
+	PlayerCount    int              `json:"player_count"`
+	StartingPlayer int              `json:"starting_player"`
+	ThrowModel     rules.ThrowModel `json:"throw_model"`
+	Rolls          []Roll           `json:"rolls"`
+}
+
+func NewServerSeed() []byte {
+	seed := make([]byte, ServerSeedSize)
+	rand.Read(seed)
+	return seed
+}
+
+func Commit(serverSeed []byte) string {
+	sum := sha256.Sum256(serverSeed)
+	return hex.EncodeToString(sum[:])
+}
+
+func StartSeed(serverSeed []byte) int64 {
+	h := sha256.New()
+	h.Write([]byte("start"))
+	h.Write(serverSeed)
+	return int64(binary.BigEndian.Uint64(h.Sum(nil)))
+}
+
+func GameSeed(serverSeed []byte, contributions []string) int64 {
+	h := sha256.New()
+	h.Write(serverSeed)
+	for _, c := range contributions {
+		binary.Write(h, binary.BigEndian, uint16(len(c)))
+		h.Write([]byte(c))
+	}
+	return int64(binary.BigEndian.Uint64(h.Sum(nil)))
+}
+
+func NewRand(seed int64) *mathrand.Rand {
+	return mathrand.New(mathrand.NewSource(seed))
+}
+
+// Verify recomputes the starting player and every roll of the log from the
+// revealed seed.
+func Verify(l Log) error {
+	serverSeed, err := hex.DecodeString(l.ServerSeed)
+	if err != nil {
+		return fmt.Errorf("bad server seed: %w", err)
+	}
+	if Commit(serverSeed) != l.Commitment {
+		return errors.New("server seed does not match the commitment")
+	}
+	if l.PlayerCount <= 0 {
+		return errors.New("bad player count")
+	}
+	startingPlayer := NewRand(StartSeed(serverSeed)).Intn(l.PlayerCount)
+	if startingPlayer != l.StartingPlayer {
+		return fmt.Errorf("starting player should be %d got %d", startingPlayer, l.StartingPlayer)
+	}
+	rng := NewRand(GameSeed(serverSeed, l.Contributions))
+	for idx, roll := range l.Rolls {
+		t := l.ThrowModel.Throw(rng)
+		if t.Roll != roll.Roll || t.Sticks != roll.Sticks {
+			return fmt.Errorf("roll %d should be %d %v got %d %v", idx, t.Roll, t.Sticks, roll.Roll, roll.Sticks)
+		}
+	}
+	return nil
+}
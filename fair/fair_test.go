@@ -0,0 +1,75 @@
+package fair
+
+import (
+	"encoding/hex"
+	"testing"
+
+	"github.com/AdventurerAmer/yutnori/rules"
+)
+
+// newLog draws the starting player and rolls of a game the way the server
+// does.
+func newLog(serverSeed []byte, contributions []string, rolls int) Log {
+	l := Log{
+		Commitment:    Commit(serverSeed),
+		ServerSeed:    hex.EncodeToString(serverSeed),
+		Contributions: contributions,
+		PlayerCount:   3,
+		ThrowModel:    rules.DefaultThrowModel,
+	}
+	l.StartingPlayer = NewRand(StartSeed(serverSeed)).Intn(l.PlayerCount)
+	rng := NewRand(GameSeed(serverSeed, contributions))
+	for range rolls {
+		t := l.ThrowModel.Throw(rng)
+		l.Rolls = append(l.Rolls, Roll{Roll: t.Roll, Sticks: t.Sticks})
+	}
+	return l
+}
+
+func TestVerify(t *testing.T) {
+	serverSeed := NewServerSeed()
+	if len(serverSeed) != ServerSeedSize {
+		t.Fatalf("got a seed of %d bytes", len(serverSeed))
+	}
+	err := Verify(newLog(serverSeed, []string{"a", "b"}, 50))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		tamper func(l *Log)
+	}{
+		{"server seed", func(l *Log) { l.ServerSeed = hex.EncodeToString(NewServerSeed()) }},
+		{"bad server seed", func(l *Log) { l.ServerSeed = "zz" }},
+		{"commitment", func(l *Log) { l.Commitment = Commit(NewServerSeed()) }},
+		{"player count", func(l *Log) { l.PlayerCount = 0 }},
+		{"starting player", func(l *Log) { l.StartingPlayer = (l.StartingPlayer + 1) % l.PlayerCount }},
+		{"contribution", func(l *Log) { l.Contributions = []string{"a", "c"} }},
+		{"roll", func(l *Log) { l.Rolls[10].Roll = l.Rolls[10].Roll%rules.Mo + 1 }},
+		{"sticks", func(l *Log) { l.Rolls[10].Sticks[0] = !l.Rolls[10].Sticks[0] }},
+	}
+	for _, test := range tests {
+		l := newLog(serverSeed, []string{"a", "b"}, 50)
+		test.tamper(&l)
+		err := Verify(l)
+		if err == nil {
+			t.Errorf("%s: verified", test.name)
+		}
+	}
+}
+
+func TestGameSeed(t *testing.T) {
+	serverSeed := NewServerSeed()
+	seeds := map[int64][]string{}
+	for _, contributions := range [][]string{nil, {"ab"}, {"a", "b"}, {"b", "a"}, {"", "ab"}} {
+		seed := GameSeed(serverSeed, contributions)
+		if other, ok := seeds[seed]; ok {
+			t.Errorf("%q and %q give the same seed", contributions, other)
+		}
+		seeds[seed] = contributions
+	}
+	if GameSeed(serverSeed, nil) == StartSeed(serverSeed) {
+		t.Error("the start and game seeds are the same")
+	}
+}
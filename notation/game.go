@@ -0,0 +1,437 @@
+package notation
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/AdventurerAmer/yutnori/replay"
+	"github.com/AdventurerAmer/yutnori/rules"
+)
+
+// Version of the game format, written in the Notation tag.
+const Version = 1
+
+var commentRegexp = regexp.MustCompile(`\{[^}]*\}`)
+
+// Export writes a recorded game as tag pairs followed by the movetext, one
+// line per turn:
+//
+//	[Notation "1"]
+//	[Pieces "2"]
+//	[Players "2"]
+//	[Player0 "alice"]
+//	[Player1 "bob"]
+//	[Start "0"]
+//	[Result "*"]
+//
+//	P0: yut gae yut:0-r3 gae:0-tr
+//	P1: geol geol:1-r2
+func Export(w io.Writer, r *replay.Replay) error {
+	b := bufio.NewWriter(w)
+	tag := func(key string, value string) {
+		fmt.Fprintf(b, "[%s %s]\n", key, strconv.Quote(value))
+	}
+	tag("Notation", strconv.Itoa(Version))
+	if r.RoomID != "" {
+		tag("Room", r.RoomID)
+	}
+	if !r.StartedAt.IsZero() {
+		tag("Started", r.StartedAt.Format(time.RFC3339))
+	}
+	tag("Pieces", strconv.Itoa(r.Settings.PieceCount))
+	tag("Teams", strconv.Itoa(r.Settings.TeamCount))
+	tag("Rules", formatRuleSet(r.Settings.Rules))
+	tag("Throw", formatThrowModel(r.Settings.ThrowModel))
+	tag("Fair", strconv.FormatBool(r.Settings.Fair))
+	tag("Seed", strconv.FormatInt(r.Seed, 10))
+	tag("Players", strconv.Itoa(len(r.Players)))
+	for idx, p := range r.Players {
+		tag(fmt.Sprintf("Player%d", idx), p.Name)
+		if p.ID != "" {
+			tag(fmt.Sprintf("PlayerID%d", idx), p.ID)
+		}
+		tag(fmt.Sprintf("Team%d", idx), strconv.Itoa(p.Team))
+	}
+	tag("Start", strconv.Itoa(r.StartingPlayer))
+	result := "*"
+	if r.Final.WinningTeam != -1 {
+		result = strconv.Itoa(r.Final.WinningTeam)
+	}
+	tag("Result", result)
+
+	var line []string
+	linePlayer := -1
+	flush := func() {
+		if len(line) != 0 {
+			fmt.Fprintf(b, "P%d: %s\n", linePlayer, strings.Join(line, " "))
+		}
+		line = line[:0]
+	}
+	b.WriteString("\n")
+	for _, e := range r.Events {
+		switch e.Kind {
+		case replay.EventRoll, replay.EventMove:
+			if e.Player != linePlayer {
+				flush()
+				linePlayer = e.Player
+			}
+			if e.Kind == replay.EventRoll {
+				line = append(line, RollName(e.Roll))
+			} else {
+				line = append(line, FormatMove(rules.Move{Roll: e.Roll, Cell: e.Cell, Piece: e.Piece, Outer: e.Outer}))
+			}
+		case replay.EventStomp:
+			if len(line) != 0 && !strings.HasSuffix(line[len(line)-1], "x") {
+				line[len(line)-1] += "x"
+			}
+		case replay.EventFinish:
+			if len(line) != 0 && !strings.HasSuffix(line[len(line)-1], "#") {
+				line[len(line)-1] += "#"
+			}
+		case replay.EventSkip:
+			if e.Player != linePlayer {
+				flush()
+				linePlayer = e.Player
+			}
+			line = append(line, "skip")
+		case replay.EventForfeit:
+			flush()
+			linePlayer = -1
+			fmt.Fprintf(b, "forfeit:%d\n", e.Player)
+		case replay.EventDisconnect:
+			flush()
+			linePlayer = -1
+			fmt.Fprintf(b, "quit:%d\n", e.Player)
+		case replay.EventConnectionLost:
+			flush()
+			linePlayer = -1
+			fmt.Fprintf(b, "lost:%d\n", e.Player)
+		case replay.EventReconnect:
+			flush()
+			linePlayer = -1
+			fmt.Fprintf(b, "reconnect:%d\n", e.Player)
+		}
+	}
+	flush()
+	return b.Flush()
+}
+
+// Import reads a game written by Export and plays it through the rules
+// engine, the returned replay carries every event the engine reported and
+// the state the game reached.
+func Import(rd io.Reader) (*replay.Replay, error) {
+	tags := map[string]string{}
+	var movetext strings.Builder
+	scanner := bufio.NewScanner(rd)
+	for lineNumber := 1; scanner.Scan(); lineNumber++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, ";") {
+			continue
+		}
+		if strings.HasPrefix(line, "[") {
+			key, value, ok := strings.Cut(strings.TrimSuffix(strings.TrimPrefix(line, "["), "]"), " ")
+			if !ok {
+				return nil, fmt.Errorf("%w: line %d: bad tag", ErrSyntax, lineNumber)
+			}
+			value, err := strconv.Unquote(strings.TrimSpace(value))
+			if err != nil {
+				return nil, fmt.Errorf("%w: line %d: bad tag value", ErrSyntax, lineNumber)
+			}
+			tags[key] = value
+			continue
+		}
+		movetext.WriteString(line)
+		movetext.WriteString("\n")
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	r, err := newReplay(tags)
+	if err != nil {
+		return nil, err
+	}
+	s, err := r.NewState()
+	if err != nil {
+		return nil, err
+	}
+
+	player := -1
+	tokens := strings.Fields(commentRegexp.ReplaceAllString(movetext.String(), " "))
+	for _, token := range tokens {
+		var events []rules.Event
+		switch {
+		case strings.HasPrefix(token, "P") && strings.HasSuffix(token, ":"):
+			player, err = strconv.Atoi(strings.TrimSuffix(strings.TrimPrefix(token, "P"), ":"))
+			if err != nil {
+				return nil, fmt.Errorf("%w: bad player '%s'", ErrSyntax, token)
+			}
+			continue
+		case strings.HasPrefix(token, "quit:"):
+			quitter, err := strconv.Atoi(strings.TrimPrefix(token, "quit:"))
+			if err != nil || quitter < 0 || quitter >= len(r.Players) {
+				return nil, fmt.Errorf("%w: bad player '%s'", ErrSyntax, token)
+			}
+			r.RecordDisconnect(quitter)
+			player = -1
+			continue
+		case strings.HasPrefix(token, "lost:"), strings.HasPrefix(token, "reconnect:"):
+			kind, index, _ := strings.Cut(token, ":")
+			idx, err := strconv.Atoi(index)
+			if err != nil || idx < 0 || idx >= len(r.Players) {
+				return nil, fmt.Errorf("%w: bad player '%s'", ErrSyntax, token)
+			}
+			if kind == "lost" {
+				r.RecordConnectionLost(idx)
+			} else {
+				r.RecordReconnect(idx)
+			}
+			player = -1
+			continue
+		case strings.HasPrefix(token, "forfeit:"):
+			forfeiter, err := strconv.Atoi(strings.TrimPrefix(token, "forfeit:"))
+			if err != nil {
+				return nil, fmt.Errorf("%w: bad player '%s'", ErrSyntax, token)
+			}
+			events, err = s.Forfeit(forfeiter)
+			if err != nil {
+				return nil, fmt.Errorf("'%s': %w", token, err)
+			}
+			player = -1
+		case token == "skip":
+			if player != -1 && player != s.Turn {
+				return nil, fmt.Errorf("'%s' is played by %d not %d", token, s.Turn, player)
+			}
+			events, err = s.SkipTurn()
+			if err != nil {
+				return nil, fmt.Errorf("'%s': %w", token, err)
+			}
+		case strings.Contains(token, ":"):
+			m, err := ParseMove(token)
+			if err != nil {
+				return nil, err
+			}
+			if player != -1 && player != s.Turn {
+				return nil, fmt.Errorf("'%s' is played by %d not %d", token, s.Turn, player)
+			}
+			events, err = s.ApplyMove(m)
+			if err != nil {
+				return nil, fmt.Errorf("'%s': %w", token, err)
+			}
+		default:
+			roll, err := ParseRoll(token)
+			if err != nil {
+				return nil, err
+			}
+			if player != -1 && player != s.Turn {
+				return nil, fmt.Errorf("'%s' is thrown by %d not %d", token, s.Turn, player)
+			}
+			events, err = s.ApplyRoll(roll)
+			if err != nil {
+				return nil, fmt.Errorf("'%s': %w", token, err)
+			}
+		}
+		r.Record(events...)
+	}
+
+	r.Final = replay.Final{
+		Teams:       slices.Clone(s.Teams),
+		Turn:        s.Turn,
+		WinningTeam: s.WinningTeam,
+		Ranking:     slices.Clone(s.Ranking),
+	}
+	if result, ok := tags["Result"]; ok && result != "*" && result != strconv.Itoa(s.WinningTeam) {
+		return nil, fmt.Errorf("result should be %s but the game ends with %d", result, s.WinningTeam)
+	}
+	return r, nil
+}
+
+// ImportState reads a game and returns the state it reaches, which is handy
+// to set up a position for analysis or a test.
+func ImportState(rd io.Reader) (*rules.State, error) {
+	r, err := Import(rd)
+	if err != nil {
+		return nil, err
+	}
+	return r.Run()
+}
+
+func newReplay(tags map[string]string) (*replay.Replay, error) {
+	atoi := func(key string, def int) (int, error) {
+		value, ok := tags[key]
+		if !ok {
+			return def, nil
+		}
+		n, err := strconv.Atoi(value)
+		if err != nil {
+			return 0, fmt.Errorf("%w: bad %s '%s'", ErrSyntax, key, value)
+		}
+		return n, nil
+	}
+
+	version, err := atoi("Notation", Version)
+	if err != nil {
+		return nil, err
+	}
+	if version < 1 || version > Version {
+		return nil, fmt.Errorf("unsupported notation version %d", version)
+	}
+
+	settings := replay.Settings{ThrowModel: rules.DefaultThrowModel}
+	settings.PieceCount, err = atoi("Pieces", rules.MinPieceCount)
+	if err != nil {
+		return nil, err
+	}
+	if settings.PieceCount < rules.MinPieceCount || settings.PieceCount > rules.MaxPieceCount {
+		return nil, fmt.Errorf("%w: Pieces should be between %d and %d", ErrSyntax, rules.MinPieceCount, rules.MaxPieceCount)
+	}
+	settings.TeamCount, err = atoi("Teams", 0)
+	if err != nil {
+		return nil, err
+	}
+	if value, ok := tags["Rules"]; ok {
+		settings.Rules, err = parseRuleSet(value)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if value, ok := tags["Throw"]; ok {
+		settings.ThrowModel, err = parseThrowModel(value)
+		if err != nil {
+			return nil, err
+		}
+	}
+	settings.Fair = tags["Fair"] == "true"
+
+	playerCount, err := atoi("Players", 0)
+	if err != nil {
+		return nil, err
+	}
+	if playerCount <= 0 {
+		return nil, fmt.Errorf("%w: missing Players tag", ErrSyntax)
+	}
+	if playerCount > rules.MaxPlayerCount {
+		return nil, fmt.Errorf("%w: Players should be at most %d", ErrSyntax, rules.MaxPlayerCount)
+	}
+	players := make([]replay.Player, playerCount)
+	for idx := range players {
+		players[idx].Name = tags[fmt.Sprintf("Player%d", idx)]
+		players[idx].ID = tags[fmt.Sprintf("PlayerID%d", idx)]
+		key := fmt.Sprintf("Team%d", idx)
+		players[idx].Team, err = atoi(key, idx)
+		if err != nil {
+			return nil, err
+		}
+		if players[idx].Team < 0 || players[idx].Team >= playerCount {
+			return nil, fmt.Errorf("%w: %s should be between 0 and %d", ErrSyntax, key, playerCount-1)
+		}
+	}
+	start, err := atoi("Start", 0)
+	if err != nil {
+		return nil, err
+	}
+
+	r := replay.New(settings, players, start)
+	r.RoomID = tags["Room"]
+	r.StartedAt = time.Time{}
+	if value, ok := tags["Started"]; ok {
+		r.StartedAt, err = time.Parse(time.RFC3339, value)
+		if err != nil {
+			return nil, fmt.Errorf("%w: bad Started '%s'", ErrSyntax, value)
+		}
+	}
+	if value, ok := tags["Seed"]; ok {
+		r.Seed, err = strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("%w: bad Seed '%s'", ErrSyntax, value)
+		}
+	}
+	return r, nil
+}
+
+func formatRuleSet(rs rules.RuleSet) string {
+	var parts []string
+	if rs.NoStacking {
+		parts = append(parts, "no-stacking")
+	}
+	if rs.NoCaptureBonus {
+		parts = append(parts, "no-capture-bonus")
+	}
+	if rs.BackdoFromStartFinishes {
+		parts = append(parts, "backdo-from-start-finishes")
+	}
+	if rs.MaxBonusThrows != 0 {
+		parts = append(parts, fmt.Sprintf("max-bonus-throws=%d", rs.MaxBonusThrows))
+	}
+	if rs.FullFinishingOrder {
+		parts = append(parts, "full-finishing-order")
+	}
+	if len(parts) == 0 {
+		return "standard"
+	}
+	return strings.Join(parts, " ")
+}
+
+func parseRuleSet(s string) (rules.RuleSet, error) {
+	rs := rules.RuleSet{}
+	for _, part := range strings.Fields(s) {
+		key, value, _ := strings.Cut(part, "=")
+		switch key {
+		case "standard":
+		case "no-stacking":
+			rs.NoStacking = true
+		case "no-capture-bonus":
+			rs.NoCaptureBonus = true
+		case "backdo-from-start-finishes":
+			rs.BackdoFromStartFinishes = true
+		case "max-bonus-throws":
+			n, err := strconv.Atoi(value)
+			if err != nil || n < 0 {
+				return rs, fmt.Errorf("%w: bad rule '%s'", ErrSyntax, part)
+			}
+			rs.MaxBonusThrows = n
+		case "full-finishing-order":
+			rs.FullFinishingOrder = true
+		default:
+			return rs, fmt.Errorf("%w: unknown rule '%s'", ErrSyntax, part)
+		}
+	}
+	return rs, nil
+}
+
+// formatThrowModel writes the flat probability of every stick followed by
+// the nak probability.
+func formatThrowModel(m rules.ThrowModel) string {
+	parts := make([]string, 0, rules.StickCount+1)
+	for _, p := range m.FlatProbabilities {
+		parts = append(parts, strconv.FormatFloat(p, 'g', -1, 64))
+	}
+	parts = append(parts, strconv.FormatFloat(m.NakProbability, 'g', -1, 64))
+	return strings.Join(parts, " ")
+}
+
+func parseThrowModel(s string) (rules.ThrowModel, error) {
+	m := rules.ThrowModel{}
+	parts := strings.Fields(s)
+	if len(parts) != rules.StickCount+1 {
+		return m, fmt.Errorf("%w: bad throw model '%s'", ErrSyntax, s)
+	}
+	for idx, part := range parts {
+		p, err := strconv.ParseFloat(part, 64)
+		if err != nil {
+			return m, fmt.Errorf("%w: bad throw model '%s'", ErrSyntax, s)
+		}
+		if idx < rules.StickCount {
+			m.FlatProbabilities[idx] = p
+		} else {
+			m.NakProbability = p
+		}
+	}
+	return m.Clamped(), nil
+}
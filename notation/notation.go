@@ -0,0 +1,142 @@
+// Package notation defines a human-readable text format for yutnori games.
+//
+// Cells are named after the board sides: "br" is the start corner, the right
+// side is "r0" to "r3" followed by "tr", the top side "t0" to "t3" and "tl",
+// the left side "l0" to "l3" and "bl", the bottom side "b0" to "b3", the
+// diagonals "md0" to "md3" and "ad0" to "ad3" with "c" at the center.
+//
+// Rolls are written by name: backdo, nak, do, gae, geol, yut and mo.
+//
+// A move is written as roll:piece-cell, for example "geol:1-c" moves the
+// second piece three cells to the center. A move that stays on the outer ring
+// at a corner branch ends with "*", and a move may be annotated with "x" when
+// it stomps a piece and "#" when it finishes, annotations are ignored when
+// reading.
+//
+// A turn passed without playing its rolls is written "skip". A player
+// forfeiting is written on its own line as "forfeit:" followed by the player
+// index, and so are a player quitting ("quit:"), losing the connection
+// ("lost:") and reconnecting ("reconnect:").
+package notation
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/AdventurerAmer/yutnori/rules"
+)
+
+var ErrSyntax = errors.New("syntax error")
+
+var cellNames = [rules.CellCount]string{
+	rules.BottomRightCorner: "br",
+	rules.Right0:            "r0",
+	rules.Right1:            "r1",
+	rules.Right2:            "r2",
+	rules.Right3:            "r3",
+	rules.TopRightCorner:    "tr",
+	rules.Top0:              "t0",
+	rules.Top1:              "t1",
+	rules.Top2:              "t2",
+	rules.Top3:              "t3",
+	rules.TopLeftCorner:     "tl",
+	rules.Left0:             "l0",
+	rules.Left1:             "l1",
+	rules.Left2:             "l2",
+	rules.Left3:             "l3",
+	rules.BottomLeftCorner:  "bl",
+	rules.Bottom0:           "b0",
+	rules.Bottom1:           "b1",
+	rules.Bottom2:           "b2",
+	rules.Bottom3:           "b3",
+	rules.MainDiagonal0:     "md0",
+	rules.MainDiagonal1:     "md1",
+	rules.MainDiagonal2:     "md2",
+	rules.MainDiagonal3:     "md3",
+	rules.AntiDiagonal0:     "ad0",
+	rules.AntiDiagonal1:     "ad1",
+	rules.AntiDiagonal2:     "ad2",
+	rules.AntiDiagonal3:     "ad3",
+	rules.Center:            "c",
+}
+
+var rollNames = map[int]string{
+	rules.Backdo: "backdo",
+	rules.Nak:    "nak",
+	rules.Do:     "do",
+	rules.Gae:    "gae",
+	rules.Geol:   "geol",
+	rules.Yut:    "yut",
+	rules.Mo:     "mo",
+}
+
+func CellName(cell rules.CellID) string {
+	if int(cell) >= len(cellNames) {
+		return "?"
+	}
+	return cellNames[cell]
+}
+
+func ParseCell(s string) (rules.CellID, error) {
+	for cell, name := range cellNames {
+		if name == s {
+			return rules.CellID(cell), nil
+		}
+	}
+	return 0, fmt.Errorf("%w: unknown cell '%s'", ErrSyntax, s)
+}
+
+func RollName(roll int) string {
+	name, ok := rollNames[roll]
+	if !ok {
+		return "?"
+	}
+	return name
+}
+
+func ParseRoll(s string) (int, error) {
+	for roll, name := range rollNames {
+		if name == s {
+			return roll, nil
+		}
+	}
+	return 0, fmt.Errorf("%w: unknown roll '%s'", ErrSyntax, s)
+}
+
+func FormatMove(m rules.Move) string {
+	s := fmt.Sprintf("%s:%d-%s", RollName(m.Roll), m.Piece, CellName(m.Cell))
+	if m.Outer {
+		s += "*"
+	}
+	return s
+}
+
+func ParseMove(s string) (rules.Move, error) {
+	s = strings.TrimRight(s, "x#")
+	m := rules.Move{}
+	if strings.HasSuffix(s, "*") {
+		m.Outer = true
+		s = strings.TrimSuffix(s, "*")
+	}
+	roll, rest, ok := strings.Cut(s, ":")
+	if !ok {
+		return m, fmt.Errorf("%w: bad move '%s'", ErrSyntax, s)
+	}
+	piece, cell, ok := strings.Cut(rest, "-")
+	if !ok {
+		return m, fmt.Errorf("%w: bad move '%s'", ErrSyntax, s)
+	}
+	var err error
+	m.Roll, err = ParseRoll(roll)
+	if err != nil {
+		return m, err
+	}
+	m.Piece, err = strconv.Atoi(piece)
+	if err != nil || m.Piece < 0 || m.Piece >= rules.MaxPieceCount {
+		return m, fmt.Errorf("%w: bad piece '%s'", ErrSyntax, piece)
+	}
+	m.Cell, err = ParseCell(cell)
+	return m, err
+}
@@ -0,0 +1,205 @@
+package notation
+
+import (
+	"bytes"
+	"errors"
+	"math/rand"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/AdventurerAmer/yutnori/replay"
+	"github.com/AdventurerAmer/yutnori/rules"
+)
+
+// playGame records a game of random moves where a turn is skipped, a player
+// loses the connection and comes back, one quits on the way and, with more
+// than two players, one forfeits.
+func playGame(t *testing.T, seed int64, teams []int, ruleSet rules.RuleSet) *replay.Replay {
+	t.Helper()
+	rng := rand.New(rand.NewSource(seed))
+	teamCount := 0
+	players := make([]replay.Player, len(teams))
+	for idx, team := range teams {
+		players[idx] = replay.Player{ID: "id" + string(rune('a'+idx)), Name: "player " + string(rune('a'+idx)), Team: team}
+		teamCount = max(teamCount, team+1)
+	}
+	if teamCount == len(teams) {
+		teamCount = 0
+	}
+	settings := replay.Settings{
+		PieceCount: 4,
+		TeamCount:  teamCount,
+		Rules:      ruleSet,
+		ThrowModel: rules.DefaultThrowModel,
+	}
+	r := replay.New(settings, players, rng.Intn(len(teams)))
+	r.RoomID = "room"
+	r.Seed = seed
+	r.StartedAt = r.StartedAt.Truncate(time.Second)
+	s, err := r.NewState()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for step := 0; s.Phase != rules.PhaseGameEnded; step++ {
+		if step == 8 {
+			r.RecordConnectionLost(s.Turn)
+			r.RecordReconnect(s.Turn)
+		}
+		if step == 10 {
+			r.RecordDisconnect(s.Turn)
+		}
+		var events []rules.Event
+		if step == 5 {
+			events, err = s.SkipTurn()
+		} else if step == 20 && len(teams) > 2 {
+			events, err = s.Forfeit(len(teams) - 1)
+		} else if s.Phase == rules.PhaseCanRoll {
+			events, err = s.ApplyRoll(rules.DefaultThrowModel.Throw(rng).Roll)
+		} else {
+			moves := s.LegalMoves()
+			events, err = s.ApplyMove(moves[rng.Intn(len(moves))])
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		r.Record(events...)
+	}
+	r.Finish(s)
+	return r
+}
+
+func TestExportImport(t *testing.T) {
+	tests := []struct {
+		name  string
+		teams []int
+		rules rules.RuleSet
+	}{
+		{"two players", []int{0, 1}, rules.RuleSet{}},
+		{"three players", []int{0, 1, 2}, rules.RuleSet{NoCaptureBonus: true, MaxBonusThrows: 2}},
+		{"teams", []int{0, 1, 0, 1}, rules.RuleSet{NoStacking: true}},
+		{"four players", []int{0, 1, 2, 3}, rules.RuleSet{BackdoFromStartFinishes: true}},
+		{"full finishing order", []int{0, 1, 2}, rules.RuleSet{FullFinishingOrder: true}},
+	}
+	for idx, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			r := playGame(t, int64(idx+1), test.teams, test.rules)
+			var b bytes.Buffer
+			err := Export(&b, r)
+			if err != nil {
+				t.Fatal(err)
+			}
+			text := b.String()
+			if !strings.Contains(text, " skip") || len(test.teams) > 2 && !strings.Contains(text, "forfeit:") {
+				t.Errorf("the skip or the forfeit is missing:\n%s", text)
+			}
+			imported, err := Import(strings.NewReader(text))
+			if err != nil {
+				t.Fatalf("%v\n%s", err, text)
+			}
+			if !reflect.DeepEqual(imported.Events, r.Events) {
+				t.Errorf("the events changed:\n%s", text)
+			}
+			if !reflect.DeepEqual(imported.Final, r.Final) {
+				t.Errorf("got final %+v want %+v", imported.Final, r.Final)
+			}
+			if !reflect.DeepEqual(imported.Settings, r.Settings) {
+				t.Errorf("got settings %+v want %+v", imported.Settings, r.Settings)
+			}
+			if !reflect.DeepEqual(imported.Players, r.Players) {
+				t.Errorf("got players %+v want %+v", imported.Players, r.Players)
+			}
+			if imported.RoomID != r.RoomID || imported.Seed != r.Seed || !imported.StartedAt.Equal(r.StartedAt) || imported.StartingPlayer != r.StartingPlayer {
+				t.Errorf("got header %s %d %v %d", imported.RoomID, imported.Seed, imported.StartedAt, imported.StartingPlayer)
+			}
+			err = imported.Verify()
+			if err != nil {
+				t.Error(err)
+			}
+
+			var again bytes.Buffer
+			err = Export(&again, imported)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if again.String() != text {
+				t.Errorf("exporting the imported game changed it:\n%s\n%s", text, again.String())
+			}
+		})
+	}
+}
+
+func TestImportErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+	}{
+		{"no players", "[Pieces \"2\"]\n"},
+		{"bad tag", "[Players 2]\n"},
+		{"too many pieces", "[Players \"2\"]\n[Pieces \"9\"]\n"},
+		{"no pieces", "[Players \"2\"]\n[Pieces \"0\"]\n"},
+		{"too many players", "[Players \"7\"]\n"},
+		{"team out of range", "[Players \"2\"]\n[Team1 \"2\"]\n"},
+		{"negative team", "[Players \"2\"]\n[Team1 \"-1\"]\n"},
+		{"unknown roll", "[Players \"2\"]\n\nP0: dog\n"},
+		{"illegal move", "[Players \"2\"]\n\nP0: gae gae:0-r0\n"},
+		{"wrong player", "[Players \"2\"]\n\nP1: gae\n"},
+		{"bad quitter", "[Players \"2\"]\n\nquit:2\n"},
+		{"bad lost connection", "[Players \"2\"]\n\nlost:x\n"},
+		{"bad reconnect", "[Players \"2\"]\n\nreconnect:-1\n"},
+		{"wrong result", "[Players \"2\"]\n[Result \"1\"]\n"},
+	}
+	for _, test := range tests {
+		_, err := Import(strings.NewReader(test.text))
+		if err == nil {
+			t.Errorf("%s: imported", test.name)
+		}
+	}
+	for _, text := range []string{"[Players 2]\n", "[Players \"1000000000\"]\n", "[Players \"2\"]\n[Team0 \"1000000000\"]\n"} {
+		_, err := Import(strings.NewReader(text))
+		if !errors.Is(err, ErrSyntax) {
+			t.Errorf("%q: got %v want a syntax error", text, err)
+		}
+	}
+}
+
+func TestImportState(t *testing.T) {
+	text := "[Players \"2\"]\n[Pieces \"2\"]\n\nP0: geol geol:0-r2 P1: yut geol geol:1-r2x yut\n"
+	s, err := ImportState(strings.NewReader(text))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.Turn != 1 || s.Phase != rules.PhaseCanRoll || !s.Teams[0].Pieces[0].IsAtStart || s.Teams[1].Pieces[1].Cell != rules.Right2 {
+		t.Errorf("got turn %d phase %d pieces %v %v", s.Turn, s.Phase, s.Teams[0].Pieces[:2], s.Teams[1].Pieces[:2])
+	}
+}
+
+func TestNames(t *testing.T) {
+	for cell := range rules.CellCount {
+		parsed, err := ParseCell(CellName(rules.CellID(cell)))
+		if err != nil || parsed != rules.CellID(cell) {
+			t.Errorf("cell %d: got %d, %v", cell, parsed, err)
+		}
+	}
+	for roll := rules.Backdo; roll <= rules.Mo; roll++ {
+		parsed, err := ParseRoll(RollName(roll))
+		if err != nil || parsed != roll {
+			t.Errorf("roll %d: got %d, %v", roll, parsed, err)
+		}
+	}
+	moves := []rules.Move{
+		{Roll: rules.Geol, Cell: rules.Center, Piece: 1},
+		{Roll: rules.Do, Cell: rules.Top0, Piece: 0, Outer: true},
+		{Roll: rules.Backdo, Cell: rules.Bottom3, Piece: 5},
+	}
+	for _, m := range moves {
+		text := FormatMove(m)
+		for _, annotated := range []string{text, text + "x", text + "#", text + "x#"} {
+			parsed, err := ParseMove(annotated)
+			if err != nil || parsed != m {
+				t.Errorf("%s: got %+v, %v", annotated, parsed, err)
+			}
+		}
+	}
+}
@@ -0,0 +1,60 @@
+// Package rating keeps persistent player identities and their skill ratings.
+//
+// Ratings use a multiplayer Elo: a finished game counts as one match between
+// every pair of opponents, the player who placed better wins it and players
+// sharing a place draw. Teammates share their team's place and are not rated
+// against each other. The rating change is divided by the number of
+// opponents so a game weighs the same whatever the player count.
+package rating
+
+import "math"
+
+const DefaultRating = 1500.0
+const K = 32.0
+
+// Result is the place of a player in a finished game, lower places are
+// better and the winner is at place zero.
+type Result struct {
+	Player string
+	Team   int
+	Place  int
+}
+
+// Expected is the score a player rated a expects against a player rated b.
+func Expected(a, b float64) float64 {
+	return 1 / (1 + math.Pow(10, (b-a)/400))
+}
+
+// Update returns the new rating of every player of the game, players missing
+// from ratings start at DefaultRating.
+func Update(ratings map[string]float64, results []Result) map[string]float64 {
+	rating := func(player string) float64 {
+		r, ok := ratings[player]
+		if !ok {
+			return DefaultRating
+		}
+		return r
+	}
+	updated := make(map[string]float64, len(results))
+	for _, a := range results {
+		score, expected, opponents := 0.0, 0.0, 0
+		for _, b := range results {
+			if a.Team == b.Team {
+				continue
+			}
+			opponents++
+			expected += Expected(rating(a.Player), rating(b.Player))
+			switch {
+			case a.Place < b.Place:
+				score += 1
+			case a.Place == b.Place:
+				score += 0.5
+			}
+		}
+		updated[a.Player] = rating(a.Player)
+		if opponents != 0 {
+			updated[a.Player] += K * (score - expected) / float64(opponents)
+		}
+	}
+	return updated
+}
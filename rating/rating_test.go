@@ -0,0 +1,115 @@
+package rating
+
+import (
+	"errors"
+	"math"
+	"path/filepath"
+	"testing"
+)
+
+func near(a, b float64) bool {
+	return math.Abs(a-b) < 1e-9
+}
+
+func TestUpdate(t *testing.T) {
+	// equal players exchange half of K
+	updated := Update(nil, []Result{{"a", 0, 0}, {"b", 1, 1}})
+	if !near(updated["a"], DefaultRating+K/2) || !near(updated["b"], DefaultRating-K/2) {
+		t.Errorf("got %v", updated)
+	}
+
+	// the favourite wins less than the underdog would have
+	ratings := map[string]float64{"a": 1700, "b": 1500}
+	favourite := Update(ratings, []Result{{"a", 0, 0}, {"b", 1, 1}})
+	underdog := Update(ratings, []Result{{"a", 0, 1}, {"b", 1, 0}})
+	if gain, loss := favourite["a"]-1700, 1700-underdog["a"]; gain <= 0 || loss <= gain {
+		t.Errorf("got a gain of %f and a loss of %f", gain, loss)
+	}
+
+	// a draw between equal players changes nothing
+	updated = Update(nil, []Result{{"a", 0, 0}, {"b", 1, 0}})
+	if !near(updated["a"], DefaultRating) || !near(updated["b"], DefaultRating) {
+		t.Errorf("got %v", updated)
+	}
+
+	// teammates share the result and are not rated against each other
+	updated = Update(nil, []Result{{"a", 0, 0}, {"b", 1, 1}, {"c", 0, 0}, {"d", 1, 1}})
+	if !near(updated["a"], DefaultRating+K/2) || !near(updated["c"], updated["a"]) || !near(updated["d"], DefaultRating-K/2) {
+		t.Errorf("got %v", updated)
+	}
+
+	// a game weighs the same whatever the player count
+	updated = Update(nil, []Result{{"a", 0, 0}, {"b", 1, 1}, {"c", 2, 2}, {"d", 3, 3}})
+	if !near(updated["a"], DefaultRating+K/2) || !near(updated["d"], DefaultRating-K/2) {
+		t.Errorf("got %v", updated)
+	}
+	total := 0.0
+	for _, r := range updated {
+		total += r - DefaultRating
+	}
+	if !near(total, 0) {
+		t.Errorf("the ratings changed by %f in total", total)
+	}
+
+	// a player alone on a team keeps the rating
+	updated = Update(nil, []Result{{"a", 0, 0}})
+	if !near(updated["a"], DefaultRating) {
+		t.Errorf("got %v", updated)
+	}
+}
+
+func TestStore(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "ratings.json")
+	s, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	a, token, err := s.Create("a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, _, err := s.Create("b")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a.Rating != DefaultRating || a.ID == b.ID {
+		t.Errorf("got %+v and %+v", a, b)
+	}
+	p, err := s.Authenticate(token)
+	if err != nil || p.ID != a.ID {
+		t.Errorf("got %+v, %v", p, err)
+	}
+	_, err = s.Authenticate("nope")
+	if !errors.Is(err, ErrUnknownToken) {
+		t.Errorf("got %v want %v", err, ErrUnknownToken)
+	}
+
+	updated, err := s.Record([]Result{{a.ID, 0, 0}, {"unknown", 1, 1}, {b.ID, 2, 2}, {a.ID, 0, 0}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(updated) != 2 || updated[0].ID != a.ID || updated[1].ID != b.ID {
+		t.Fatalf("got %+v", updated)
+	}
+	if updated[0].Rating <= DefaultRating || updated[0].Games != 1 || updated[0].Wins != 1 {
+		t.Errorf("got %+v", updated[0])
+	}
+	if updated[1].Rating >= DefaultRating || updated[1].Games != 1 || updated[1].Wins != 0 {
+		t.Errorf("got %+v", updated[1])
+	}
+	if s.Rating("unknown") != DefaultRating {
+		t.Errorf("got %f for an unknown player", s.Rating("unknown"))
+	}
+
+	reopened, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p, err = reopened.Authenticate(token)
+	if err != nil || p != updated[0] {
+		t.Errorf("got %+v, %v want %+v", p, err, updated[0])
+	}
+	if reopened.Rating(b.ID) != updated[1].Rating {
+		t.Errorf("got %f want %f", reopened.Rating(b.ID), updated[1].Rating)
+	}
+}
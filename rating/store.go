@@ -0,0 +1,190 @@
+package rating
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base32"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"time"
+)
+
+var ErrUnknownToken = errors.New("unknown identity token")
+
+// Player is a persistent identity. Clients prove they own it with a secret
+// token, only its hash is stored.
+type Player struct {
+	ID        string    `json:"id"`
+	Name      string    `json:"name"`
+	TokenHash string    `json:"token_hash"`
+	Rating    float64   `json:"rating"`
+	Games     int       `json:"games"`
+	Wins      int       `json:"wins"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// Store keeps the players in a JSON file that is rewritten after each change,
+// it is safe for concurrent use.
+type Store struct {
+	path    string
+	mu      sync.Mutex
+	players map[string]*Player
+	tokens  map[string]string // token hash to player ID
+}
+
+func Open(path string) (*Store, error) {
+	s := &Store{
+		path:    path,
+		players: make(map[string]*Player),
+		tokens:  make(map[string]string),
+	}
+	b, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	players := []*Player{}
+	err = json.Unmarshal(b, &players)
+	if err != nil {
+		return nil, err
+	}
+	for _, p := range players {
+		s.players[p.ID] = p
+		s.tokens[p.TokenHash] = p.ID
+	}
+	return s, nil
+}
+
+// Create makes a new identity and returns it with the token that proves it.
+func (s *Store) Create(name string) (Player, string, error) {
+	token := newID(32)
+	p := &Player{
+		ID:        newID(10),
+		Name:      name,
+		TokenHash: hashToken(token),
+		Rating:    DefaultRating,
+		UpdatedAt: time.Now().UTC(),
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.players[p.ID] = p
+	s.tokens[p.TokenHash] = p.ID
+	return *p, token, s.save()
+}
+
+func (s *Store) Authenticate(token string) (Player, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	id, ok := s.tokens[hashToken(token)]
+	if !ok {
+		return Player{}, ErrUnknownToken
+	}
+	return *s.players[id], nil
+}
+
+func (s *Store) Get(id string) (Player, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	p, ok := s.players[id]
+	if !ok {
+		return Player{}, false
+	}
+	return *p, true
+}
+
+// Rating is the rating of id, or DefaultRating for an unknown player.
+func (s *Store) Rating(id string) float64 {
+	p, ok := s.Get(id)
+	if !ok {
+		return DefaultRating
+	}
+	return p.Rating
+}
+
+// Record rates a finished game and returns the updated players in the order
+// of the results, results of unknown players are ignored.
+func (s *Store) Record(results []Result) ([]Player, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	known := []Result{}
+	ratings := map[string]float64{}
+	for _, r := range results {
+		p, ok := s.players[r.Player]
+		if !ok {
+			continue
+		}
+		if _, seen := ratings[r.Player]; seen {
+			continue
+		}
+		known = append(known, r)
+		ratings[r.Player] = p.Rating
+	}
+	ratings = Update(ratings, known)
+	updated := []Player{}
+	now := time.Now().UTC()
+	for _, r := range known {
+		p := s.players[r.Player]
+		p.Rating = ratings[r.Player]
+		p.Games++
+		if r.Place == 0 {
+			p.Wins++
+		}
+		p.UpdatedAt = now
+		updated = append(updated, *p)
+	}
+	return updated, s.save()
+}
+
+// save writes to a temporary file first so a crash never leaves a truncated
+// store behind.
+func (s *Store) save() error {
+	players := make([]*Player, 0, len(s.players))
+	for _, p := range s.players {
+		players = append(players, p)
+	}
+	slices.SortFunc(players, func(a, b *Player) int {
+		return a.UpdatedAt.Compare(b.UpdatedAt)
+	})
+	b, err := json.MarshalIndent(players, "", "  ")
+	if err != nil {
+		return err
+	}
+	dir := filepath.Dir(s.path)
+	err = os.MkdirAll(dir, 0o755)
+	if err != nil {
+		return err
+	}
+	f, err := os.CreateTemp(dir, ".ratings-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	_, err = f.Write(b)
+	if err == nil {
+		err = f.Close()
+	} else {
+		f.Close()
+	}
+	if err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), s.path)
+}
+
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+func newID(size int) string {
+	b := make([]byte, size)
+	rand.Read(b)
+	return base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString(b)
+}
@@ -0,0 +1,298 @@
+// Package replay records games as versioned event logs and plays them back
+// through the rules engine.
+package replay
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"time"
+
+	"github.com/AdventurerAmer/yutnori/rules"
+)
+
+const Version = 1
+
+type EventKind string
+
+const (
+	EventRoll           EventKind = "roll"
+	EventMove           EventKind = "move"
+	EventStomp          EventKind = "stomp"
+	EventFinish         EventKind = "finish"
+	EventEndGame        EventKind = "end_game"
+	EventDisconnect     EventKind = "disconnect" // the player left the game
+	EventTeamFinished   EventKind = "team_finished"
+	EventSkip           EventKind = "skip"
+	EventForfeit        EventKind = "forfeit"
+	EventConnectionLost EventKind = "connection_lost" // the seat waits for the player to reconnect
+	EventReconnect      EventKind = "reconnect"
+)
+
+// Event is a single entry of the log. Rolls, moves, skips, forfeits and
+// connection changes are the inputs of the game, the other kinds are what
+// the rules engine made of them and are checked when the log is replayed.
+type Event struct {
+	Kind     EventKind    `json:"kind"`
+	Player   int          `json:"player"`
+	Team     int          `json:"team,omitempty"`
+	Roll     int          `json:"roll,omitempty"`
+	Appended bool         `json:"appended,omitempty"`
+	Cell     rules.CellID `json:"cell,omitempty"`
+	Piece    int          `json:"piece,omitempty"`
+	Outer    bool         `json:"outer,omitempty"`
+}
+
+type Settings struct {
+	PieceCount int              `json:"piece_count"`
+	TeamCount  int              `json:"team_count"`
+	Rules      rules.RuleSet    `json:"rules"`
+	ThrowModel rules.ThrowModel `json:"throw_model"`
+	Fair       bool             `json:"fair"`
+}
+
+// Player is a seat of the game, Team is the team index used by the rules
+// engine, so it is the seat index itself in a game without teams.
+type Player struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+	Team int    `json:"team"`
+}
+
+type Final struct {
+	Teams       []rules.Team `json:"teams"`
+	Turn        int          `json:"turn"`
+	WinningTeam int          `json:"winning_team"`
+	Ranking     []int        `json:"ranking,omitempty"`
+}
+
+type Replay struct {
+	Version        int       `json:"version"`
+	RoomID         string    `json:"room_id"`
+	StartedAt      time.Time `json:"started_at"`
+	EndedAt        time.Time `json:"ended_at"`
+	Seed           int64     `json:"seed"`
+	Settings       Settings  `json:"settings"`
+	Players        []Player  `json:"players"`
+	StartingPlayer int       `json:"starting_player"`
+	Events         []Event   `json:"events"`
+	Final          Final     `json:"final"`
+}
+
+func New(settings Settings, players []Player, startingPlayer int) *Replay {
+	return &Replay{
+		Version:        Version,
+		StartedAt:      time.Now().UTC(),
+		Settings:       settings,
+		Players:        players,
+		StartingPlayer: startingPlayer,
+		Final:          Final{WinningTeam: -1},
+	}
+}
+
+func (r *Replay) Record(events ...rules.Event) {
+	for _, event := range events {
+		switch e := event.(type) {
+		case rules.RollEvent:
+			r.Events = append(r.Events, Event{Kind: EventRoll, Player: e.Player, Roll: e.Roll, Appended: e.Appended})
+		case rules.MoveEvent:
+			r.Events = append(r.Events, Event{
+				Kind:   EventMove,
+				Player: e.Player,
+				Roll:   e.Move.Roll,
+				Cell:   e.Move.Cell,
+				Piece:  e.Move.Piece,
+				Outer:  e.Move.Outer,
+			})
+			if e.Finished {
+				r.Events = append(r.Events, Event{Kind: EventFinish, Player: e.Player, Piece: e.Move.Piece})
+			}
+		case rules.StompEvent:
+			r.Events = append(r.Events, Event{Kind: EventStomp, Player: e.Stomper, Team: e.Team, Piece: e.Piece})
+		case rules.SkipEvent:
+			r.Events = append(r.Events, Event{Kind: EventSkip, Player: e.Player})
+		case rules.ForfeitEvent:
+			r.Events = append(r.Events, Event{Kind: EventForfeit, Player: e.Player, Team: e.Team})
+		case rules.TeamFinishedEvent:
+			r.Events = append(r.Events, Event{Kind: EventTeamFinished, Player: e.Player, Team: e.Team})
+		case rules.EndGameEvent:
+			r.Events = append(r.Events, Event{Kind: EventEndGame, Player: e.Player, Team: e.Team})
+		}
+	}
+}
+
+func (r *Replay) RecordDisconnect(player int) {
+	r.Events = append(r.Events, Event{Kind: EventDisconnect, Player: player})
+}
+
+func (r *Replay) RecordConnectionLost(player int) {
+	r.Events = append(r.Events, Event{Kind: EventConnectionLost, Player: player})
+}
+
+func (r *Replay) RecordReconnect(player int) {
+	r.Events = append(r.Events, Event{Kind: EventReconnect, Player: player})
+}
+
+// Finish stamps the end of the game and keeps the final state to check
+// against when the log is replayed.
+func (r *Replay) Finish(s *rules.State) {
+	r.EndedAt = time.Now().UTC()
+	r.Final = Final{
+		Teams:       slices.Clone(s.Teams),
+		Turn:        s.Turn,
+		WinningTeam: s.WinningTeam,
+		Ranking:     slices.Clone(s.Ranking),
+	}
+}
+
+func (r *Replay) FileName() string {
+	return fmt.Sprintf("%s-%d.json", r.RoomID, r.StartedAt.Unix())
+}
+
+func (r *Replay) Save(dir string) (string, error) {
+	err := os.MkdirAll(dir, 0o755)
+	if err != nil {
+		return "", err
+	}
+	path := filepath.Join(dir, r.FileName())
+	f, err := os.Create(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	return path, r.Write(f)
+}
+
+func (r *Replay) Write(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(r)
+}
+
+func Load(path string) (*Replay, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return Read(f)
+}
+
+func Read(rd io.Reader) (*Replay, error) {
+	r := &Replay{}
+	err := json.NewDecoder(rd).Decode(r)
+	if err != nil {
+		return nil, err
+	}
+	if r.Version < 1 || r.Version > Version {
+		return nil, fmt.Errorf("unsupported replay version %d", r.Version)
+	}
+	err = r.check()
+	if err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// check rejects settings and players no game could have been played with,
+// before they size the state of the game.
+func (r *Replay) check() error {
+	s := r.Settings
+	if s.PieceCount < rules.MinPieceCount || s.PieceCount > rules.MaxPieceCount {
+		return fmt.Errorf("piece count %d is not between %d and %d", s.PieceCount, rules.MinPieceCount, rules.MaxPieceCount)
+	}
+	if len(r.Players) < rules.MinPlayerCount || len(r.Players) > rules.MaxPlayerCount {
+		return fmt.Errorf("player count %d is not between %d and %d", len(r.Players), rules.MinPlayerCount, rules.MaxPlayerCount)
+	}
+	for idx, p := range r.Players {
+		if p.Team < 0 || p.Team >= len(r.Players) {
+			return fmt.Errorf("player %d is in team %d of %d players", idx, p.Team, len(r.Players))
+		}
+	}
+	return nil
+}
+
+// NewState returns the state the game started from.
+func (r *Replay) NewState() (*rules.State, error) {
+	err := r.check()
+	if err != nil {
+		return nil, err
+	}
+	teams := make([]int, len(r.Players))
+	for idx, p := range r.Players {
+		teams[idx] = p.Team
+	}
+	s, err := rules.NewTeamState(teams, r.Settings.PieceCount)
+	if err != nil {
+		return nil, err
+	}
+	s.Rules = r.Settings.Rules
+	_, err = s.Start(r.StartingPlayer)
+	if err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Apply feeds an input of the game to the rules engine, the other kinds of
+// events are ignored.
+func Apply(s *rules.State, e Event) ([]rules.Event, error) {
+	switch e.Kind {
+	case EventRoll:
+		return s.ApplyRoll(e.Roll)
+	case EventMove:
+		return s.ApplyMove(rules.Move{Roll: e.Roll, Cell: e.Cell, Piece: e.Piece, Outer: e.Outer})
+	case EventSkip:
+		return s.SkipTurn()
+	case EventForfeit:
+		return s.Forfeit(e.Player)
+	}
+	return nil, nil
+}
+
+// Run feeds the rolls and moves of the log to the rules engine and checks
+// that it reports exactly the logged events, it returns the resulting state.
+func (r *Replay) Run() (*rules.State, error) {
+	s, err := r.NewState()
+	if err != nil {
+		return nil, err
+	}
+	rerun := Replay{}
+	for idx, e := range r.Events {
+		if e.Kind == EventDisconnect || e.Kind == EventConnectionLost || e.Kind == EventReconnect {
+			rerun.Events = append(rerun.Events, e)
+			continue
+		}
+		events, err := Apply(s, e)
+		if err != nil {
+			return s, fmt.Errorf("event %d (%s): %w", idx, e.Kind, err)
+		}
+		rerun.Record(events...)
+	}
+	for idx := range max(len(r.Events), len(rerun.Events)) {
+		if idx >= len(r.Events) || idx >= len(rerun.Events) || r.Events[idx] != rerun.Events[idx] {
+			return s, fmt.Errorf("event %d does not match the rules engine", idx)
+		}
+	}
+	return s, nil
+}
+
+// Verify replays the log and checks it reaches the recorded final state, the
+// ranking is only checked when the replay has one.
+func (r *Replay) Verify() error {
+	s, err := r.Run()
+	if err != nil {
+		return err
+	}
+	if s.WinningTeam != r.Final.WinningTeam || s.Turn != r.Final.Turn || !slices.Equal(s.Teams, r.Final.Teams) {
+		return errors.New("final state does not match the replay")
+	}
+	if r.Final.Ranking != nil && !slices.Equal(s.Ranking, r.Final.Ranking) {
+		return errors.New("final ranking does not match the replay")
+	}
+	return nil
+}
@@ -0,0 +1,157 @@
+package replay
+
+import (
+	"bytes"
+	"math/rand"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/AdventurerAmer/yutnori/rules"
+)
+
+// playGame records a two player game of random moves, the second player
+// loses the connection and comes back, then disconnects on the way and the
+// game goes on.
+func playGame(t *testing.T, seed int64) *Replay {
+	t.Helper()
+	rng := rand.New(rand.NewSource(seed))
+	players := []Player{{ID: "a", Name: "a", Team: 0}, {ID: "b", Name: "b", Team: 1}}
+	r := New(Settings{PieceCount: 4, ThrowModel: rules.DefaultThrowModel}, players, 0)
+	r.RoomID = "room"
+	s, err := r.NewState()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for step := 0; s.Phase != rules.PhaseGameEnded; step++ {
+		if step == 3 {
+			r.RecordConnectionLost(1)
+			r.RecordReconnect(1)
+		}
+		if step == 5 {
+			r.RecordDisconnect(1)
+		}
+		var events []rules.Event
+		if s.Phase == rules.PhaseCanRoll {
+			events, err = s.ApplyRoll(rules.DefaultThrowModel.Throw(rng).Roll)
+		} else {
+			moves := s.LegalMoves()
+			events, err = s.ApplyMove(moves[rng.Intn(len(moves))])
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		r.Record(events...)
+	}
+	r.Finish(s)
+	return r
+}
+
+func TestWriteRead(t *testing.T) {
+	r := playGame(t, 1)
+	var b bytes.Buffer
+	err := r.Write(&b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	read, err := Read(&b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(read.Events, r.Events) || !reflect.DeepEqual(read.Final, r.Final) || !reflect.DeepEqual(read.Settings, r.Settings) {
+		t.Error("the replay changed")
+	}
+	err = read.Verify()
+	if err != nil {
+		t.Error(err)
+	}
+}
+
+func TestSaveLoad(t *testing.T) {
+	r := playGame(t, 1)
+	path, err := r.Save(filepath.Join(t.TempDir(), "replays"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if filepath.Base(path) != r.FileName() {
+		t.Errorf("saved to %s want %s", path, r.FileName())
+	}
+	loaded, err := Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(loaded.Events, r.Events) || !loaded.StartedAt.Equal(r.StartedAt) {
+		t.Error("the replay changed")
+	}
+}
+
+func TestReadErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+	}{
+		{"version", `{"version": 2, "settings": {"piece_count": 4}}`},
+		{"no version", `{"settings": {"piece_count": 4}}`},
+		{"not json", `version 1`},
+		{"too many pieces", `{"version": 1, "settings": {"piece_count": 9}}`},
+		{"no pieces", `{"version": 1, "settings": {"piece_count": 0}}`},
+		{"one player", `{"version": 1, "settings": {"piece_count": 4}, "players": [{"id": "a", "team": 0}]}`},
+		{"team", `{"version": 1, "settings": {"piece_count": 4}, "players": [{"id": "a", "team": 0}, {"id": "b", "team": 1000000000}]}`},
+	}
+	for _, test := range tests {
+		_, err := Read(strings.NewReader(test.text))
+		if err == nil {
+			t.Errorf("%s: read", test.name)
+		}
+	}
+}
+
+func TestVerify(t *testing.T) {
+	tests := []struct {
+		name   string
+		tamper func(r *Replay)
+	}{
+		{"roll", func(r *Replay) {
+			for idx, e := range r.Events {
+				if e.Kind == EventRoll {
+					r.Events[idx].Roll = e.Roll%rules.Mo + 1
+					return
+				}
+			}
+		}},
+		{"stomp", func(r *Replay) {
+			for idx, e := range r.Events {
+				if e.Kind == EventStomp {
+					r.Events = append(r.Events[:idx], r.Events[idx+1:]...)
+					return
+				}
+			}
+		}},
+		{"missing events", func(r *Replay) { r.Events = r.Events[:len(r.Events)-1] }},
+		{"winner", func(r *Replay) { r.Final.WinningTeam = 1 - r.Final.WinningTeam }},
+		{"turn", func(r *Replay) { r.Final.Turn = 1 - r.Final.Turn }},
+		{"pieces", func(r *Replay) { r.Settings.PieceCount = 3 }},
+		{"too many pieces", func(r *Replay) { r.Settings.PieceCount = rules.MaxPieceCount + 1 }},
+		{"too many players", func(r *Replay) {
+			for len(r.Players) <= rules.MaxPlayerCount {
+				r.Players = append(r.Players, Player{Team: len(r.Players)})
+			}
+		}},
+		{"negative team", func(r *Replay) { r.Players[1].Team = -1 }},
+		{"team out of range", func(r *Replay) { r.Players[1].Team = 1 << 40 }},
+		{"starting player", func(r *Replay) { r.StartingPlayer = 2 }},
+	}
+	for _, test := range tests {
+		r := playGame(t, 2)
+		err := r.Verify()
+		if err != nil {
+			t.Fatal(err)
+		}
+		test.tamper(r)
+		err = r.Verify()
+		if err == nil {
+			t.Errorf("%s: verified", test.name)
+		}
+	}
+}
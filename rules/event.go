@@ -0,0 +1,76 @@
+package rules
+
+// Event describes something that happened while applying a roll or a move.
+// Players are referred to by their index in State.Players.
+type Event interface {
+	event()
+}
+
+type RollEvent struct {
+	Player   int
+	Roll     int
+	Appended bool
+}
+
+type CallRollEvent struct {
+	Player int
+}
+
+type SelectingMoveEvent struct {
+	Player int
+}
+
+type EndTurnEvent struct {
+	Player     int
+	NextPlayer int
+}
+
+type MoveEvent struct {
+	Player   int
+	Move     Move
+	Finished bool
+}
+
+type StompEvent struct {
+	Team    int
+	Piece   int
+	Stomper int
+}
+
+// TeamFinishedEvent reports a team that finished all its pieces while the
+// game goes on, Place starts at zero for the winner.
+type TeamFinishedEvent struct {
+	Player int
+	Team   int
+	Place  int
+}
+
+// SkipEvent reports a turn passed without playing its rolls.
+type SkipEvent struct {
+	Player int
+}
+
+// ForfeitEvent reports a player leaving the game, TeamOut is set when no
+// player of the team is left.
+type ForfeitEvent struct {
+	Player  int
+	Team    int
+	TeamOut bool
+}
+
+// EndGameEvent reports the winning team and the player who made the last move.
+type EndGameEvent struct {
+	Player int
+	Team   int
+}
+
+func (RollEvent) event()          {}
+func (CallRollEvent) event()      {}
+func (SelectingMoveEvent) event() {}
+func (EndTurnEvent) event()       {}
+func (MoveEvent) event()          {}
+func (StompEvent) event()         {}
+func (TeamFinishedEvent) event()  {}
+func (SkipEvent) event()          {}
+func (ForfeitEvent) event()       {}
+func (EndGameEvent) event()       {}
@@ -0,0 +1,22 @@
+package rules
+
+// RuleSet holds the house rules a game is played with, the zero value is the
+// standard game.
+type RuleSet struct {
+	// NoStacking makes every piece move on its own, pieces sharing a cell
+	// are not carried along.
+	NoStacking bool `json:"no_stacking"`
+	// NoCaptureBonus takes away the extra throw for stomping a piece.
+	NoCaptureBonus bool `json:"no_capture_bonus"`
+	// BackdoFromStartFinishes lets a piece waiting at start use a backdo to
+	// step back over the finish line, instead of the backdo being discarded.
+	// The piece finishes outright, it does not wait on the last cell for
+	// another lap.
+	BackdoFromStartFinishes bool `json:"backdo_from_start_finishes"`
+	// MaxBonusThrows caps the consecutive extra throws granted for yut, mo
+	// and stomping, zero means no cap.
+	MaxBonusThrows int `json:"max_bonus_throws"`
+	// FullFinishingOrder keeps the game going after the first team finishes,
+	// finished teams leave the turn rotation until a single team is left.
+	FullFinishingOrder bool `json:"full_finishing_order"`
+}
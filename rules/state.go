@@ -0,0 +1,477 @@
+// Package rules implements the yutnori rules as a network-free state machine.
+// The caller throws the sticks and picks the moves, the State validates them
+// and reports what happened as a list of events.
+package rules
+
+import (
+	"errors"
+	"slices"
+)
+
+const MaxPieceCount = 6
+const MinPieceCount = 2
+const MaxPlayerCount = 6
+const MinPlayerCount = 2
+
+var (
+	ErrIllegalPhase = errors.New("action is not allowed in the current phase")
+	ErrIllegalRoll  = errors.New("illegal roll")
+	ErrIllegalMove  = errors.New("illegal move")
+	ErrIllegalTeams = errors.New("illegal teams")
+)
+
+type Phase uint8
+
+const (
+	PhaseGameEnded Phase = iota
+	PhaseCanRoll
+	PhaseSelectingMove
+)
+
+// Move moves Piece by Roll to Cell. Outer is set when a piece leaving a
+// branch corner stays on the outer ring instead of taking the shortcut.
+type Move struct {
+	Roll  int
+	Cell  CellID
+	Piece int
+	Outer bool
+}
+
+// Path is the route a move takes, Cells ends at the destination cell.
+type Path struct {
+	Cells    []CellID
+	Outer    bool
+	Finished bool
+}
+
+type Player struct {
+	Team      int
+	Forfeited bool
+}
+
+// Team owns a set of pieces shared by all of its players, in a game without
+// teams every player is alone in its own team.
+type Team struct {
+	Pieces [MaxPieceCount]Piece `json:"pieces"`
+}
+
+type State struct {
+	Rules       RuleSet
+	Players     []Player
+	Teams       []Team
+	Order       []int
+	PieceCount  int
+	Phase       Phase
+	Turn        int
+	Rolls       []int
+	BonusThrows int
+	WinningTeam int
+	Ranking     []int // teams in the order they finished, complete once the game ends
+	Eliminated  []int // teams whose players all forfeited, in the order they did
+}
+
+func NewState(playerCount int, pieceCount int) *State {
+	teams := make([]int, playerCount)
+	for playerIdx := range teams {
+		teams[playerIdx] = playerIdx
+	}
+	s, _ := NewTeamState(teams, pieceCount)
+	return s
+}
+
+// NewTeamState creates a game where teams[i] is the team of the i-th player.
+// Teams are numbered from zero and turns alternate between teams.
+func NewTeamState(teams []int, pieceCount int) (*State, error) {
+	teamCount := 0
+	for _, team := range teams {
+		if team < 0 {
+			return nil, ErrIllegalTeams
+		}
+		teamCount = max(teamCount, team+1)
+	}
+	s := &State{
+		Players:     make([]Player, len(teams)),
+		Teams:       make([]Team, teamCount),
+		PieceCount:  pieceCount,
+		Phase:       PhaseGameEnded,
+		WinningTeam: -1,
+	}
+	members := make([][]int, teamCount)
+	for playerIdx, team := range teams {
+		s.Players[playerIdx].Team = team
+		members[team] = append(members[team], playerIdx)
+	}
+	for teamIdx := range s.Teams {
+		if len(members[teamIdx]) == 0 {
+			return nil, ErrIllegalTeams
+		}
+		for pieceIdx := range s.Teams[teamIdx].Pieces {
+			s.Teams[teamIdx].Pieces[pieceIdx] = StartPiece()
+		}
+	}
+	for round := 0; len(s.Order) != len(s.Players); round++ {
+		for _, team := range members {
+			if round < len(team) {
+				s.Order = append(s.Order, team[round])
+			}
+		}
+	}
+	return s, nil
+}
+
+// Clone returns a deep copy that can be played on without touching s.
+func (s *State) Clone() *State {
+	c := *s
+	c.Players = slices.Clone(s.Players)
+	c.Teams = slices.Clone(s.Teams)
+	c.Order = slices.Clone(s.Order)
+	c.Rolls = slices.Clone(s.Rolls)
+	c.Ranking = slices.Clone(s.Ranking)
+	c.Eliminated = slices.Clone(s.Eliminated)
+	return &c
+}
+
+func (s *State) Start(firstPlayer int) ([]Event, error) {
+	if s.Phase != PhaseGameEnded || s.WinningTeam != -1 {
+		return nil, ErrIllegalPhase
+	}
+	if firstPlayer < 0 || firstPlayer >= len(s.Players) {
+		return nil, ErrIllegalMove
+	}
+	s.Turn = firstPlayer
+	s.Phase = PhaseCanRoll
+	return []Event{CallRollEvent{Player: s.Turn}}, nil
+}
+
+func (s *State) CurrentTeam() *Team {
+	return &s.Teams[s.Players[s.Turn].Team]
+}
+
+func (s *State) TeamMembers(team int) []int {
+	var members []int
+	for playerIdx, p := range s.Players {
+		if p.Team == team {
+			members = append(members, playerIdx)
+		}
+	}
+	return members
+}
+
+// NextPlayer is the player after the current one in the turn order, players
+// who forfeited or whose team finished are skipped.
+func (s *State) NextPlayer() int {
+	pos := slices.Index(s.Order, s.Turn)
+	for step := 1; step < len(s.Order); step++ {
+		player := s.Order[(pos+step)%len(s.Order)]
+		if !s.Players[player].Forfeited && !s.IsTeamFinished(s.Players[player].Team) {
+			return player
+		}
+	}
+	return s.Turn
+}
+
+func (s *State) IsTeamFinished(team int) bool {
+	return slices.Contains(s.Ranking, team)
+}
+
+// IsTeamOut reports whether the team no longer plays, because it finished or
+// because all of its players forfeited.
+func (s *State) IsTeamOut(team int) bool {
+	return s.IsTeamFinished(team) || slices.Contains(s.Eliminated, team)
+}
+
+// SkipTurn throws away the rolls of the current player and passes the turn.
+func (s *State) SkipTurn() ([]Event, error) {
+	if s.Phase == PhaseGameEnded {
+		return nil, ErrIllegalPhase
+	}
+	s.Rolls = s.Rolls[:0]
+	events := []Event{SkipEvent{Player: s.Turn}}
+	return append(events, s.continueTurn()...), nil
+}
+
+// Forfeit takes the player out of the turn rotation. A team keeps playing
+// while one of its players is left, once they all forfeited its pieces leave
+// the board and it is ranked after the teams still playing.
+func (s *State) Forfeit(player int) ([]Event, error) {
+	if s.Phase == PhaseGameEnded {
+		return nil, ErrIllegalPhase
+	}
+	if player < 0 || player >= len(s.Players) || s.Players[player].Forfeited {
+		return nil, ErrIllegalMove
+	}
+	s.Players[player].Forfeited = true
+	team := s.Players[player].Team
+	teamOut := true
+	for _, member := range s.TeamMembers(team) {
+		if !s.Players[member].Forfeited {
+			teamOut = false
+		}
+	}
+	if teamOut && !s.IsTeamFinished(team) {
+		s.Eliminated = append(s.Eliminated, team)
+		for pieceIdx := range s.Teams[team].Pieces {
+			s.Teams[team].Pieces[pieceIdx] = StartPiece()
+		}
+	}
+	events := []Event{ForfeitEvent{Player: player, Team: team, TeamOut: teamOut}}
+	if len(s.remainingTeams()) <= 1 {
+		return append(events, s.endGame(player)), nil
+	}
+	if player == s.Turn {
+		s.Rolls = s.Rolls[:0]
+		events = append(events, s.continueTurn()...)
+	}
+	return events, nil
+}
+
+func (s *State) remainingTeams() []int {
+	remaining := []int{}
+	for team := range s.Teams {
+		if !s.IsTeamOut(team) {
+			remaining = append(remaining, team)
+		}
+	}
+	return remaining
+}
+
+// endGame completes the ranking when it can, the last team playing comes
+// after the teams that finished and the eliminated teams come last, the
+// last one to go out first.
+func (s *State) endGame(player int) Event {
+	remaining := s.remainingTeams()
+	if len(remaining) == 1 {
+		s.Ranking = append(s.Ranking, remaining[0])
+	}
+	if len(remaining) <= 1 {
+		for idx := len(s.Eliminated) - 1; idx >= 0; idx-- {
+			s.Ranking = append(s.Ranking, s.Eliminated[idx])
+		}
+	}
+	if s.WinningTeam == -1 {
+		s.WinningTeam = s.Ranking[0]
+	}
+	s.Phase = PhaseGameEnded
+	s.Rolls = s.Rolls[:0]
+	return EndGameEvent{Player: player, Team: s.WinningTeam}
+}
+
+func (s *State) ApplyRoll(roll int) ([]Event, error) {
+	if s.Phase != PhaseCanRoll {
+		return nil, ErrIllegalPhase
+	}
+	if roll < Backdo || roll > Mo {
+		return nil, ErrIllegalRoll
+	}
+
+	shouldAppend := true
+	if roll == Nak {
+		shouldAppend = false
+		s.Rolls = s.Rolls[:0]
+	}
+	if roll == Backdo && !s.Rules.BackdoFromStartFinishes &&
+		s.allPiecesAtStart(s.Players[s.Turn].Team) && len(s.Rolls) == 0 {
+		shouldAppend = false
+	}
+	if shouldAppend {
+		s.Rolls = append(s.Rolls, roll)
+	}
+
+	events := []Event{RollEvent{Player: s.Turn, Roll: roll, Appended: shouldAppend}}
+	if !IsBonusRoll(roll) {
+		s.BonusThrows = 0
+	} else if s.grantBonusThrow() {
+		return append(events, CallRollEvent{Player: s.Turn}), nil
+	}
+	return append(events, s.continueTurn()...), nil
+}
+
+func (s *State) LegalMoves() []Move {
+	if s.Phase != PhaseSelectingMove {
+		return nil
+	}
+	return s.legalMoves()
+}
+
+// CheckMove reports whether the current player can make the move and
+// returns the path the moved pieces take.
+func (s *State) CheckMove(m Move) (Path, error) {
+	if s.Phase != PhaseSelectingMove {
+		return Path{}, ErrIllegalPhase
+	}
+	if !slices.Contains(s.Rolls, m.Roll) || m.Piece < 0 || m.Piece >= s.PieceCount {
+		return Path{}, ErrIllegalMove
+	}
+	path, ok := resolveMove(s.CurrentTeam().Pieces[m.Piece], m, s.Rules)
+	if !ok {
+		return Path{}, ErrIllegalMove
+	}
+	return path, nil
+}
+
+func (s *State) ApplyMove(m Move) ([]Event, error) {
+	path, err := s.CheckMove(m)
+	if err != nil {
+		return nil, err
+	}
+	finished := path.Finished
+	rollIdx := slices.Index(s.Rolls, m.Roll)
+	s.Rolls = slices.Delete(s.Rolls, rollIdx, rollIdx+1)
+
+	teamIdx := s.Players[s.Turn].Team
+	team := &s.Teams[teamIdx]
+	pieceToMove := team.Pieces[m.Piece]
+
+	// moving pieces, pieces sharing a cell on the board move together
+	if pieceToMove.IsAtStart || s.Rules.NoStacking {
+		team.Pieces[m.Piece] = Piece{Cell: m.Cell, IsFinished: finished}
+	} else {
+		for pieceIdx := 0; pieceIdx < s.PieceCount; pieceIdx++ {
+			piece := team.Pieces[pieceIdx]
+			if piece.IsFinished || piece.IsAtStart || piece.Cell != pieceToMove.Cell {
+				continue
+			}
+			piece.Cell = m.Cell
+			piece.IsFinished = finished
+			team.Pieces[pieceIdx] = piece
+		}
+	}
+	events := []Event{MoveEvent{Player: s.Turn, Move: m, Finished: finished}}
+
+	// stomping opponent pieces, a finishing piece ends on the corner it passes
+	// and stomps the pieces standing there
+	stomped := false
+	for opponentIdx := 0; opponentIdx < len(s.Teams); opponentIdx++ {
+		if opponentIdx == teamIdx {
+			continue
+		}
+		opponent := &s.Teams[opponentIdx]
+		for pieceIdx := 0; pieceIdx < s.PieceCount; pieceIdx++ {
+			piece := opponent.Pieces[pieceIdx]
+			if piece.IsFinished || piece.IsAtStart || piece.Cell != m.Cell {
+				continue
+			}
+			opponent.Pieces[pieceIdx] = StartPiece()
+			stomped = true
+			events = append(events, StompEvent{Team: opponentIdx, Piece: pieceIdx, Stomper: s.Turn})
+		}
+	}
+
+	if s.finishedPieceCount(teamIdx) == s.PieceCount {
+		s.Ranking = append(s.Ranking, teamIdx)
+		if s.WinningTeam == -1 {
+			s.WinningTeam = teamIdx
+		}
+		s.Rolls = s.Rolls[:0]
+		if !s.Rules.FullFinishingOrder || len(s.remainingTeams()) <= 1 {
+			return append(events, s.endGame(s.Turn)), nil
+		}
+		events = append(events, TeamFinishedEvent{Player: s.Turn, Team: teamIdx, Place: len(s.Ranking) - 1})
+		return append(events, s.continueTurn()...), nil
+	}
+	if stomped && !s.Rules.NoCaptureBonus && s.grantBonusThrow() {
+		s.Phase = PhaseCanRoll
+		return append(events, CallRollEvent{Player: s.Turn}), nil
+	}
+	return append(events, s.continueTurn()...), nil
+}
+
+// continueTurn lets the current player select a move if any of the pending
+// rolls can be used, otherwise the remaining rolls are dropped and the turn
+// passes to the next player. The original server kept such rolls, a back-do
+// left over once every piece on the board had finished had no legal move and
+// the player was stuck selecting a move forever.
+func (s *State) continueTurn() []Event {
+	if len(s.Rolls) != 0 && len(s.legalMoves()) != 0 {
+		s.Phase = PhaseSelectingMove
+		return []Event{SelectingMoveEvent{Player: s.Turn}}
+	}
+	s.Rolls = s.Rolls[:0]
+	s.BonusThrows = 0
+	prev := s.Turn
+	s.Turn = s.NextPlayer()
+	s.Phase = PhaseCanRoll
+	return []Event{
+		EndTurnEvent{Player: prev, NextPlayer: s.Turn},
+		CallRollEvent{Player: s.Turn},
+	}
+}
+
+func (s *State) legalMoves() []Move {
+	var moves []Move
+	team := s.CurrentTeam()
+	for rollIdx, roll := range s.Rolls {
+		if slices.Contains(s.Rolls[:rollIdx], roll) {
+			continue
+		}
+		for pieceIdx := 0; pieceIdx < s.PieceCount; pieceIdx++ {
+			piece := team.Pieces[pieceIdx]
+			if piece.IsFinished {
+				continue
+			}
+			for _, path := range movePaths(piece, roll, s.Rules) {
+				moves = append(moves, Move{
+					Roll:  roll,
+					Cell:  path.Cells[len(path.Cells)-1],
+					Piece: pieceIdx,
+					Outer: path.Outer,
+				})
+			}
+		}
+	}
+	return moves
+}
+
+func (s *State) grantBonusThrow() bool {
+	if s.Rules.MaxBonusThrows != 0 && s.BonusThrows >= s.Rules.MaxBonusThrows {
+		return false
+	}
+	s.BonusThrows++
+	return true
+}
+
+func (s *State) allPiecesAtStart(teamIdx int) bool {
+	for _, piece := range s.Teams[teamIdx].Pieces[:s.PieceCount] {
+		if !piece.IsAtStart {
+			return false
+		}
+	}
+	return true
+}
+
+func (s *State) finishedPieceCount(teamIdx int) int {
+	count := 0
+	for _, piece := range s.Teams[teamIdx].Pieces[:s.PieceCount] {
+		if piece.IsFinished {
+			count++
+		}
+	}
+	return count
+}
+
+func movePaths(piece Piece, roll int, rules RuleSet) []Path {
+	if piece.IsFinished {
+		return nil
+	}
+	if roll == Backdo && piece.IsAtStart && rules.BackdoFromStartFinishes {
+		return []Path{{Cells: []CellID{BottomRightCorner}, Finished: true}}
+	}
+	seq0, seq1, finished := getMoveSeq(piece, roll)
+	var paths []Path
+	if len(seq0) != 0 {
+		paths = append(paths, Path{Cells: seq0, Finished: finished})
+	}
+	if len(seq1) != 0 {
+		paths = append(paths, Path{Cells: seq1, Outer: roll != Backdo, Finished: finished})
+	}
+	return paths
+}
+
+func resolveMove(piece Piece, m Move, rules RuleSet) (Path, bool) {
+	for _, path := range movePaths(piece, m.Roll, rules) {
+		if path.Cells[len(path.Cells)-1] == m.Cell && path.Outer == m.Outer {
+			return path, true
+		}
+	}
+	return Path{}, false
+}
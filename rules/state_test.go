@@ -0,0 +1,620 @@
+package rules
+
+import (
+	"errors"
+	"reflect"
+	"slices"
+	"testing"
+)
+
+// newGame starts a game where player 0 rolls first.
+func newGame(t *testing.T, playerCount int, pieceCount int) *State {
+	t.Helper()
+	s := NewState(playerCount, pieceCount)
+	_, err := s.Start(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+// selecting puts s in the move selection of player 0 with the given rolls.
+func selecting(s *State, rolls ...int) {
+	s.Turn = 0
+	s.Phase = PhaseSelectingMove
+	s.Rolls = rolls
+}
+
+func hasEvent[E Event](events []Event) bool {
+	return slices.ContainsFunc(events, func(e Event) bool {
+		_, ok := e.(E)
+		return ok
+	})
+}
+
+func TestStart(t *testing.T) {
+	s := NewState(2, 2)
+	_, err := s.Start(2)
+	if !errors.Is(err, ErrIllegalMove) {
+		t.Errorf("start with player 2: got %v want %v", err, ErrIllegalMove)
+	}
+	events, err := s.Start(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.Turn != 1 || s.Phase != PhaseCanRoll || !slices.Equal(events, []Event{CallRollEvent{Player: 1}}) {
+		t.Errorf("got turn %d phase %d events %#v", s.Turn, s.Phase, events)
+	}
+	_, err = s.Start(0)
+	if !errors.Is(err, ErrIllegalPhase) {
+		t.Errorf("start twice: got %v want %v", err, ErrIllegalPhase)
+	}
+}
+
+func TestApplyRollErrors(t *testing.T) {
+	s := NewState(2, 2)
+	_, err := s.ApplyRoll(Do)
+	if !errors.Is(err, ErrIllegalPhase) {
+		t.Errorf("roll before the start: got %v want %v", err, ErrIllegalPhase)
+	}
+	s = newGame(t, 2, 2)
+	for _, roll := range []int{Backdo - 1, Mo + 1} {
+		_, err = s.ApplyRoll(roll)
+		if !errors.Is(err, ErrIllegalRoll) {
+			t.Errorf("roll %d: got %v want %v", roll, err, ErrIllegalRoll)
+		}
+	}
+}
+
+func TestApplyRoll(t *testing.T) {
+	tests := []struct {
+		name     string
+		rolls    []int
+		phase    Phase
+		turn     int
+		pending  []int
+		appended bool
+	}{
+		{"a move roll selects a move", []int{Geol}, PhaseSelectingMove, 0, []int{Geol}, true},
+		{"yut throws again", []int{Yut}, PhaseCanRoll, 0, []int{Yut}, true},
+		{"mo throws again", []int{Mo}, PhaseCanRoll, 0, []int{Mo}, true},
+		{"bonus rolls add up", []int{Yut, Mo, Gae}, PhaseSelectingMove, 0, []int{Yut, Mo, Gae}, true},
+		{"nak passes the turn", []int{Nak}, PhaseCanRoll, 1, []int{}, false},
+		{"nak drops the pending rolls", []int{Yut, Nak}, PhaseCanRoll, 1, []int{}, false},
+		{"backdo from the start is dropped", []int{Backdo}, PhaseCanRoll, 1, []int{}, false},
+		{"backdo after a bonus roll is kept", []int{Yut, Backdo}, PhaseSelectingMove, 0, []int{Yut, Backdo}, true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			s := newGame(t, 2, 2)
+			var events []Event
+			for _, roll := range test.rolls {
+				var err error
+				events, err = s.ApplyRoll(roll)
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+			if s.Phase != test.phase || s.Turn != test.turn {
+				t.Errorf("got phase %d turn %d want phase %d turn %d", s.Phase, s.Turn, test.phase, test.turn)
+			}
+			if !slices.Equal(s.Rolls, test.pending) {
+				t.Errorf("got rolls %v want %v", s.Rolls, test.pending)
+			}
+			roll, ok := events[0].(RollEvent)
+			if !ok || roll.Appended != test.appended {
+				t.Errorf("got %#v want a roll event appended %t", events[0], test.appended)
+			}
+		})
+	}
+}
+
+func TestMaxBonusThrows(t *testing.T) {
+	s := newGame(t, 2, 2)
+	s.Rules.MaxBonusThrows = 1
+	s.ApplyRoll(Yut)
+	s.ApplyRoll(Yut)
+	if s.Phase != PhaseSelectingMove || !slices.Equal(s.Rolls, []int{Yut, Yut}) {
+		t.Errorf("got phase %d rolls %v, the second yut should not throw again", s.Phase, s.Rolls)
+	}
+
+	// a stomp past the cap does not throw again either
+	s = newGame(t, 2, 2)
+	s.Rules.MaxBonusThrows = 1
+	s.Teams[1].Pieces[0] = Piece{Cell: Right3}
+	s.ApplyRoll(Yut)
+	_, err := s.ApplyRoll(Yut)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = s.ApplyMove(Move{Roll: Yut, Cell: Right3})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.Phase != PhaseSelectingMove || s.Turn != 0 {
+		t.Errorf("got phase %d turn %d, the stomp should not throw again", s.Phase, s.Turn)
+	}
+}
+
+func TestLegalMoves(t *testing.T) {
+	s := newGame(t, 2, 3)
+	if moves := s.LegalMoves(); moves != nil {
+		t.Errorf("got %v before rolling", moves)
+	}
+
+	// the pieces at start all enter the board the same way
+	selecting(s, Geol)
+	moves := s.LegalMoves()
+	if len(moves) != 3 {
+		t.Fatalf("got %d moves want 3", len(moves))
+	}
+	for idx, m := range moves {
+		want := Move{Roll: Geol, Cell: Right2, Piece: idx}
+		if m != want {
+			t.Errorf("got %+v want %+v", m, want)
+		}
+	}
+
+	// a repeated roll gives no more moves, a finished piece has none
+	s.Teams[0].Pieces[1].IsFinished = true
+	selecting(s, Do, Do)
+	if moves := s.LegalMoves(); len(moves) != 2 {
+		t.Errorf("got %d moves want 2: %v", len(moves), moves)
+	}
+
+	// a piece on a branch corner takes the shortcut or stays outside
+	s = newGame(t, 2, 2)
+	s.Teams[0].Pieces[0] = Piece{Cell: TopRightCorner}
+	s.Teams[0].Pieces[1].IsFinished = true
+	selecting(s, Do)
+	moves = s.LegalMoves()
+	if len(moves) != 2 {
+		t.Fatalf("got %d moves want 2: %v", len(moves), moves)
+	}
+	outer := slices.IndexFunc(moves, func(m Move) bool { return m.Outer })
+	if outer == -1 || moves[outer].Cell != Top0 || moves[1-outer].Cell == Top0 {
+		t.Errorf("got %v want an outer move to the top side and a shortcut", moves)
+	}
+}
+
+func TestCheckMove(t *testing.T) {
+	s := newGame(t, 2, 2)
+	s.Teams[0].Pieces[0] = Piece{Cell: TopLeftCorner}
+	selecting(s, Geol)
+	path, err := s.CheckMove(Move{Roll: Geol, Cell: Left2, Outer: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := Path{Cells: []CellID{Left0, Left1, Left2}, Outer: true}
+	if !slices.Equal(path.Cells, want.Cells) || path.Outer != want.Outer || path.Finished {
+		t.Errorf("got path %+v want %+v", path, want)
+	}
+	path, err = s.CheckMove(Move{Roll: Geol, Cell: Center})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if path.Outer || path.Cells[len(path.Cells)-1] != Center {
+		t.Errorf("got path %+v want the shortcut to the center", path)
+	}
+}
+
+func TestApplyMoveErrors(t *testing.T) {
+	s := newGame(t, 2, 2)
+	_, err := s.ApplyMove(Move{Roll: Do, Cell: Right0})
+	if !errors.Is(err, ErrIllegalPhase) {
+		t.Errorf("move before rolling: got %v want %v", err, ErrIllegalPhase)
+	}
+	selecting(s, Gae)
+	illegal := []Move{
+		{Roll: Do, Cell: Right0},            // not rolled
+		{Roll: Gae, Cell: Right0},           // wrong cell
+		{Roll: Gae, Cell: Right1, Piece: 2}, // no such piece
+		{Roll: Gae, Cell: Right1, Outer: true},
+	}
+	for _, m := range illegal {
+		_, err = s.ApplyMove(m)
+		if !errors.Is(err, ErrIllegalMove) {
+			t.Errorf("%+v: got %v want %v", m, err, ErrIllegalMove)
+		}
+	}
+	if !slices.Equal(s.Rolls, []int{Gae}) {
+		t.Errorf("illegal moves used a roll, rolls are %v", s.Rolls)
+	}
+}
+
+func TestApplyMove(t *testing.T) {
+	s := newGame(t, 2, 2)
+	selecting(s, Gae)
+	events, err := s.ApplyMove(Move{Roll: Gae, Cell: Right1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.Teams[0].Pieces[0] != (Piece{Cell: Right1}) || !s.Teams[0].Pieces[1].IsAtStart {
+		t.Errorf("got pieces %v", s.Teams[0].Pieces[:2])
+	}
+	if !hasEvent[MoveEvent](events) || !hasEvent[EndTurnEvent](events) {
+		t.Errorf("got events %#v want a move and the end of the turn", events)
+	}
+	if s.Turn != 1 || s.Phase != PhaseCanRoll || len(s.Rolls) != 0 {
+		t.Errorf("got turn %d phase %d rolls %v", s.Turn, s.Phase, s.Rolls)
+	}
+}
+
+func TestApplyMoveStacking(t *testing.T) {
+	for _, noStacking := range []bool{false, true} {
+		s := newGame(t, 2, 3)
+		s.Rules.NoStacking = noStacking
+		s.Teams[0].Pieces[0] = Piece{Cell: Right0}
+		s.Teams[0].Pieces[1] = Piece{Cell: Right0}
+		selecting(s, Do)
+		_, err := s.ApplyMove(Move{Roll: Do, Cell: Right1})
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := Right1
+		if noStacking {
+			want = Right0
+		}
+		if s.Teams[0].Pieces[0].Cell != Right1 || s.Teams[0].Pieces[1].Cell != want || !s.Teams[0].Pieces[2].IsAtStart {
+			t.Errorf("no stacking %t: got pieces %v", noStacking, s.Teams[0].Pieces[:3])
+		}
+	}
+}
+
+func TestApplyMoveStomp(t *testing.T) {
+	for _, noBonus := range []bool{false, true} {
+		s := newGame(t, 2, 2)
+		s.Rules.NoCaptureBonus = noBonus
+		s.Teams[1].Pieces[0] = Piece{Cell: Right2}
+		selecting(s, Geol)
+		events, err := s.ApplyMove(Move{Roll: Geol, Cell: Right2})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !s.Teams[1].Pieces[0].IsAtStart {
+			t.Errorf("the stomped piece is at %v", s.Teams[1].Pieces[0])
+		}
+		stomp := slices.IndexFunc(events, func(e Event) bool { return e == StompEvent{Team: 1, Piece: 0, Stomper: 0} })
+		if stomp == -1 {
+			t.Errorf("got events %#v want a stomp", events)
+		}
+		wantTurn := 0
+		if noBonus {
+			wantTurn = 1
+		}
+		if s.Phase != PhaseCanRoll || s.Turn != wantTurn {
+			t.Errorf("no capture bonus %t: got phase %d turn %d want turn %d", noBonus, s.Phase, s.Turn, wantTurn)
+		}
+	}
+}
+
+func TestApplyMoveFinish(t *testing.T) {
+	s := newGame(t, 2, 2)
+	s.Teams[0].Pieces[0] = Piece{Cell: Bottom3}
+	s.Teams[0].Pieces[1] = Piece{Cell: BottomRightCorner, IsFinished: true}
+	selecting(s, Gae, Do)
+	events, err := s.ApplyMove(Move{Roll: Gae, Cell: BottomRightCorner})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !s.Teams[0].Pieces[0].IsFinished {
+		t.Errorf("got piece %v want it finished", s.Teams[0].Pieces[0])
+	}
+	end := slices.IndexFunc(events, func(e Event) bool { return e == EndGameEvent{Player: 0, Team: 0} })
+	if end == -1 || s.Phase != PhaseGameEnded || s.WinningTeam != 0 || len(s.Rolls) != 0 {
+		t.Errorf("got events %#v phase %d winning team %d rolls %v", events, s.Phase, s.WinningTeam, s.Rolls)
+	}
+}
+
+func TestApplyMoveFinishStomps(t *testing.T) {
+	s := newGame(t, 2, 3)
+	s.Teams[0].Pieces[0] = Piece{Cell: Bottom3}
+	s.Teams[1].Pieces[0] = Piece{Cell: BottomRightCorner}
+	selecting(s, Gae)
+	events, err := s.ApplyMove(Move{Roll: Gae, Cell: BottomRightCorner})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !hasEvent[StompEvent](events) || !s.Teams[1].Pieces[0].IsAtStart {
+		t.Errorf("got events %#v and piece %v want a stomp", events, s.Teams[1].Pieces[0])
+	}
+}
+
+// Rolls no piece can use are dropped and the turn passes.
+func TestApplyMoveDropsUnusableRolls(t *testing.T) {
+	s := newGame(t, 2, 3)
+	s.Teams[0].Pieces[0] = Piece{Cell: Bottom3}
+	s.Teams[0].Pieces[1] = Piece{Cell: BottomRightCorner, IsFinished: true}
+	selecting(s, Gae, Backdo)
+	events, err := s.ApplyMove(Move{Roll: Gae, Cell: BottomRightCorner})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !hasEvent[EndTurnEvent](events) || s.Turn != 1 || len(s.Rolls) != 0 {
+		t.Errorf("got events %#v turn %d rolls %v", events, s.Turn, s.Rolls)
+	}
+}
+
+func TestNewTeamState(t *testing.T) {
+	for _, teams := range [][]int{{0, -1}, {0, 2}} {
+		_, err := NewTeamState(teams, 2)
+		if !errors.Is(err, ErrIllegalTeams) {
+			t.Errorf("teams %v: got %v want %v", teams, err, ErrIllegalTeams)
+		}
+	}
+	s, err := NewTeamState([]int{0, 0, 1, 1}, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(s.Teams) != 2 || !slices.Equal(s.TeamMembers(1), []int{2, 3}) {
+		t.Errorf("got %d teams and members %v of team 1", len(s.Teams), s.TeamMembers(1))
+	}
+}
+
+// Turns alternate between the teams, every member of a team plays in turn.
+func TestTeamTurnOrder(t *testing.T) {
+	s, err := NewTeamState([]int{0, 0, 1, 1}, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(s.Order, []int{0, 2, 1, 3}) {
+		t.Errorf("got order %v", s.Order)
+	}
+	_, err = s.Start(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	turns := []int{}
+	for range 5 {
+		_, err = s.ApplyRoll(Nak)
+		if err != nil {
+			t.Fatal(err)
+		}
+		turns = append(turns, s.Turn)
+	}
+	if !slices.Equal(turns, []int{2, 1, 3, 0, 2}) {
+		t.Errorf("got turns %v", turns)
+	}
+
+	// an uneven team plays its members in turn against a lone opponent
+	s, err = NewTeamState([]int{0, 0, 1}, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(s.Order, []int{0, 2, 1}) {
+		t.Errorf("got order %v", s.Order)
+	}
+}
+
+// Teammates move the same pieces, they stack instead of stomping each other.
+func TestTeamSharesPieces(t *testing.T) {
+	s, err := NewTeamState([]int{0, 1, 0, 1}, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = s.Start(2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.Teams[0].Pieces[0] = Piece{Cell: Right2}
+	s.Phase = PhaseSelectingMove
+	s.Rolls = []int{Geol}
+	events, err := s.ApplyMove(Move{Roll: Geol, Cell: Right2, Piece: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hasEvent[StompEvent](events) || s.Teams[0].Pieces[0].Cell != Right2 || s.Teams[0].Pieces[1].Cell != Right2 {
+		t.Errorf("got events %#v pieces %v, the teammates' pieces should stack", events, s.Teams[0].Pieces[:2])
+	}
+	if s.Players[s.Turn].Team != 1 {
+		t.Errorf("got turn %d want a player of the other team", s.Turn)
+	}
+
+	// the pieces player 2 moved are player 0's to finish
+	s.Teams[0].Pieces[0] = Piece{Cell: Bottom3}
+	s.Teams[0].Pieces[1] = Piece{Cell: BottomRightCorner, IsFinished: true}
+	selecting(s, Gae)
+	events, err = s.ApplyMove(Move{Roll: Gae, Cell: BottomRightCorner})
+	if err != nil {
+		t.Fatal(err)
+	}
+	end := slices.IndexFunc(events, func(e Event) bool { return e == EndGameEvent{Player: 0, Team: 0} })
+	if end == -1 || s.WinningTeam != 0 {
+		t.Errorf("got events %#v winning team %d", events, s.WinningTeam)
+	}
+}
+
+// A backdo with every piece at start finishes a piece outright under
+// BackdoFromStartFinishes, it is dropped otherwise.
+func TestBackdoFromStartFinishes(t *testing.T) {
+	s := newGame(t, 2, 2)
+	s.Rules.BackdoFromStartFinishes = true
+	_, err := s.ApplyRoll(Backdo)
+	if err != nil {
+		t.Fatal(err)
+	}
+	moves := s.LegalMoves()
+	want := []Move{{Roll: Backdo, Cell: BottomRightCorner, Piece: 0}, {Roll: Backdo, Cell: BottomRightCorner, Piece: 1}}
+	if s.Phase != PhaseSelectingMove || !slices.Equal(moves, want) {
+		t.Fatalf("got phase %d moves %v want %v", s.Phase, moves, want)
+	}
+	events, err := s.ApplyMove(moves[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	move, ok := events[0].(MoveEvent)
+	if !ok || !move.Finished || !s.Teams[0].Pieces[0].IsFinished || !s.Teams[0].Pieces[1].IsAtStart {
+		t.Errorf("got events %#v pieces %v want the first piece finished", events, s.Teams[0].Pieces[:2])
+	}
+}
+
+func TestFullFinishingOrder(t *testing.T) {
+	s := newGame(t, 3, 1)
+	s.Rules.FullFinishingOrder = true
+	s.Teams[0].Pieces[0] = Piece{Cell: Bottom3}
+	selecting(s, Gae)
+	events, err := s.ApplyMove(Move{Roll: Gae, Cell: BottomRightCorner})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Contains(events, Event(TeamFinishedEvent{Player: 0, Team: 0, Place: 0})) || hasEvent[EndGameEvent](events) {
+		t.Errorf("got events %#v", events)
+	}
+	if s.Phase != PhaseCanRoll || s.Turn != 1 || s.WinningTeam != 0 || !slices.Equal(s.Ranking, []int{0}) {
+		t.Errorf("got phase %d turn %d winning team %d ranking %v", s.Phase, s.Turn, s.WinningTeam, s.Ranking)
+	}
+
+	// the finished team is out of the turn rotation
+	s.Turn = 2
+	if next := s.NextPlayer(); next != 1 {
+		t.Errorf("got next player %d want 1", next)
+	}
+
+	s.Teams[2].Pieces[0] = Piece{Cell: Bottom3}
+	s.Phase = PhaseSelectingMove
+	s.Rolls = []int{Gae}
+	events, err = s.ApplyMove(Move{Roll: Gae, Cell: BottomRightCorner})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Contains(events, Event(EndGameEvent{Player: 2, Team: 0})) || s.Phase != PhaseGameEnded {
+		t.Errorf("got events %#v phase %d", events, s.Phase)
+	}
+	if !slices.Equal(s.Ranking, []int{0, 2, 1}) || s.WinningTeam != 0 {
+		t.Errorf("got ranking %v winning team %d", s.Ranking, s.WinningTeam)
+	}
+
+	// without the rule the first team to finish ends the game
+	s = newGame(t, 3, 1)
+	s.Teams[0].Pieces[0] = Piece{Cell: Bottom3}
+	selecting(s, Gae)
+	events, err = s.ApplyMove(Move{Roll: Gae, Cell: BottomRightCorner})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !hasEvent[EndGameEvent](events) || s.Phase != PhaseGameEnded || !slices.Equal(s.Ranking, []int{0}) {
+		t.Errorf("got events %#v phase %d ranking %v", events, s.Phase, s.Ranking)
+	}
+}
+
+func TestSkipTurn(t *testing.T) {
+	s := newGame(t, 2, 2)
+	selecting(s, Gae, Do)
+	events, err := s.SkipTurn()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Contains(events, Event(SkipEvent{Player: 0})) || s.Turn != 1 || s.Phase != PhaseCanRoll || len(s.Rolls) != 0 {
+		t.Errorf("got events %#v turn %d phase %d rolls %v", events, s.Turn, s.Phase, s.Rolls)
+	}
+	s.Phase = PhaseGameEnded
+	_, err = s.SkipTurn()
+	if !errors.Is(err, ErrIllegalPhase) {
+		t.Errorf("got %v want %v", err, ErrIllegalPhase)
+	}
+}
+
+func TestForfeit(t *testing.T) {
+	s := newGame(t, 3, 2)
+	s.Teams[1].Pieces[0] = Piece{Cell: Right2}
+	events, err := s.Forfeit(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Contains(events, Event(ForfeitEvent{Player: 1, Team: 1, TeamOut: true})) || s.Turn != 0 {
+		t.Errorf("got events %#v turn %d", events, s.Turn)
+	}
+	if !s.Teams[1].Pieces[0].IsAtStart || !s.IsTeamOut(1) {
+		t.Errorf("the pieces of the team that went out are still on the board: %v", s.Teams[1].Pieces[0])
+	}
+	if next := s.NextPlayer(); next != 2 {
+		t.Errorf("got next player %d want 2", next)
+	}
+	for _, player := range []int{1, -1, 3} {
+		_, err = s.Forfeit(player)
+		if !errors.Is(err, ErrIllegalMove) {
+			t.Errorf("player %d: got %v want %v", player, err, ErrIllegalMove)
+		}
+	}
+
+	// the current player forfeiting passes the turn
+	selecting(s, Gae)
+	events, err = s.Forfeit(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !hasEvent[EndGameEvent](events) || s.Phase != PhaseGameEnded {
+		t.Fatalf("got events %#v phase %d", events, s.Phase)
+	}
+	// the last team out is ranked before the ones that went out earlier
+	if !slices.Equal(s.Ranking, []int{2, 0, 1}) || s.WinningTeam != 2 || len(s.Rolls) != 0 {
+		t.Errorf("got ranking %v winning team %d rolls %v", s.Ranking, s.WinningTeam, s.Rolls)
+	}
+	_, err = s.Forfeit(2)
+	if !errors.Is(err, ErrIllegalPhase) {
+		t.Errorf("got %v want %v", err, ErrIllegalPhase)
+	}
+
+	s = newGame(t, 4, 2)
+	selecting(s, Gae)
+	events, err = s.Forfeit(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !hasEvent[EndTurnEvent](events) || s.Turn != 1 || s.Phase != PhaseCanRoll || len(s.Rolls) != 0 {
+		t.Errorf("got events %#v turn %d phase %d rolls %v", events, s.Turn, s.Phase, s.Rolls)
+	}
+}
+
+// A team plays on while one of its players is left.
+func TestForfeitTeam(t *testing.T) {
+	s, err := NewTeamState([]int{0, 1, 0, 1}, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = s.Start(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.Teams[0].Pieces[0] = Piece{Cell: Right2}
+	events, err := s.Forfeit(2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Contains(events, Event(ForfeitEvent{Player: 2, Team: 0})) || s.IsTeamOut(0) || s.Teams[0].Pieces[0].Cell != Right2 {
+		t.Errorf("got events %#v pieces %v", events, s.Teams[0].Pieces[:2])
+	}
+	s.Turn = 3
+	if next := s.NextPlayer(); next != 0 {
+		t.Errorf("got next player %d want 0", next)
+	}
+	events, err = s.Forfeit(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Contains(events, Event(EndGameEvent{Player: 0, Team: 1})) || !slices.Equal(s.Ranking, []int{1, 0}) {
+		t.Errorf("got events %#v ranking %v", events, s.Ranking)
+	}
+}
+
+func TestClone(t *testing.T) {
+	s := newGame(t, 3, 2)
+	selecting(s, Gae, Do)
+	s.Ranking = []int{1}
+	s.Eliminated = []int{2}
+	c := s.Clone()
+	if !reflect.DeepEqual(c, s) {
+		t.Fatalf("got %+v want %+v", c, s)
+	}
+	_, err := c.ApplyMove(Move{Roll: Gae, Cell: Right1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.Players[0].Forfeited = true
+	c.Order[0] = 2
+	c.Ranking[0] = 0
+	c.Eliminated[0] = 0
+	if !s.Teams[0].Pieces[0].IsAtStart || len(s.Rolls) != 2 || s.Players[0].Forfeited || s.Order[0] != 0 || s.Ranking[0] != 1 || s.Eliminated[0] != 2 {
+		t.Errorf("playing on the clone changed the state: %+v", s)
+	}
+}
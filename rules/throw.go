@@ -0,0 +1,112 @@
+package rules
+
+import "math/rand"
+
+const (
+	Backdo = -1
+	Nak    = 0
+	Do     = 1
+	Gae    = 2
+	Geol   = 3
+	Yut    = 4
+	Mo     = 5
+)
+
+const StickCount = 4
+
+// BackdoStick is the index of the marked stick, when it is the only one
+// landing flat side up the throw is a backdo instead of a do.
+const BackdoStick = 0
+
+func IsBonusRoll(roll int) bool {
+	return roll == Yut || roll == Mo
+}
+
+// ThrowModel simulates the four yut sticks one by one.
+type ThrowModel struct {
+	// FlatProbabilities is the chance of each stick landing flat side up.
+	FlatProbabilities [StickCount]float64 `json:"flat_probabilities"`
+	// NakProbability is the chance of a stick falling off the mat, which
+	// forfeits the pending rolls.
+	NakProbability float64 `json:"nak_probability"`
+}
+
+var DefaultThrowModel = ThrowModel{
+	FlatProbabilities: [StickCount]float64{0.6, 0.6, 0.6, 0.6},
+	NakProbability:    0.05,
+}
+
+// Throw is the outcome of a throw, Sticks[i] is set when the i-th stick
+// landed flat side up.
+type Throw struct {
+	Roll   int
+	Sticks [StickCount]bool
+}
+
+// Clamped returns the model with every probability limited to [0, 1].
+func (m ThrowModel) Clamped() ThrowModel {
+	for idx, p := range m.FlatProbabilities {
+		m.FlatProbabilities[idx] = min(max(p, 0), 1)
+	}
+	m.NakProbability = min(max(m.NakProbability, 0), 1)
+	return m
+}
+
+// Throw draws every stick and then the chance of a nak from rng, in that
+// order, so a seeded rng always produces the same sequence of throws.
+func (m ThrowModel) Throw(rng *rand.Rand) Throw {
+	t := Throw{}
+	for idx, p := range m.FlatProbabilities {
+		t.Sticks[idx] = rng.Float64() < p
+	}
+	if rng.Float64() < m.NakProbability {
+		t.Roll = Nak
+		return t
+	}
+	t.Roll = RollFromSticks(t.Sticks)
+	return t
+}
+
+// RollProbabilities is the chance of every roll, indexed by the roll minus
+// Backdo.
+func (m ThrowModel) RollProbabilities() [Mo - Backdo + 1]float64 {
+	var probs [Mo - Backdo + 1]float64
+	probs[Nak-Backdo] = m.NakProbability
+	for mask := 0; mask < 1<<StickCount; mask++ {
+		var sticks [StickCount]bool
+		p := 1 - m.NakProbability
+		for idx := range sticks {
+			sticks[idx] = mask&(1<<idx) != 0
+			if sticks[idx] {
+				p *= m.FlatProbabilities[idx]
+			} else {
+				p *= 1 - m.FlatProbabilities[idx]
+			}
+		}
+		probs[RollFromSticks(sticks)-Backdo] += p
+	}
+	return probs
+}
+
+func RollFromSticks(sticks [StickCount]bool) int {
+	flatCount := 0
+	for _, flat := range sticks {
+		if flat {
+			flatCount++
+		}
+	}
+	switch flatCount {
+	case 0:
+		return Mo
+	case 1:
+		if sticks[BackdoStick] {
+			return Backdo
+		}
+		return Do
+	case 2:
+		return Gae
+	case 3:
+		return Geol
+	}
+	return Yut
+}
@@ -0,0 +1,124 @@
+package rules
+
+import (
+	"math"
+	"math/rand"
+	"slices"
+	"testing"
+)
+
+func TestRollFromSticks(t *testing.T) {
+	tests := []struct {
+		sticks [StickCount]bool
+		roll   int
+	}{
+		{[StickCount]bool{false, false, false, false}, Mo},
+		{[StickCount]bool{true, false, false, false}, Backdo},
+		{[StickCount]bool{false, true, false, false}, Do},
+		{[StickCount]bool{false, false, false, true}, Do},
+		{[StickCount]bool{true, true, false, false}, Gae},
+		{[StickCount]bool{false, true, false, true}, Gae},
+		{[StickCount]bool{true, true, true, false}, Geol},
+		{[StickCount]bool{false, true, true, true}, Geol},
+		{[StickCount]bool{true, true, true, true}, Yut},
+	}
+	for _, test := range tests {
+		if roll := RollFromSticks(test.sticks); roll != test.roll {
+			t.Errorf("%v: got %d want %d", test.sticks, roll, test.roll)
+		}
+	}
+}
+
+func TestClamped(t *testing.T) {
+	m := ThrowModel{
+		FlatProbabilities: [StickCount]float64{-0.5, 0, 0.3, 1.5},
+		NakProbability:    2,
+	}.Clamped()
+	want := ThrowModel{
+		FlatProbabilities: [StickCount]float64{0, 0, 0.3, 1},
+		NakProbability:    1,
+	}
+	if m != want {
+		t.Errorf("got %+v want %+v", m, want)
+	}
+	if DefaultThrowModel.Clamped() != DefaultThrowModel {
+		t.Errorf("the default model is not clamped")
+	}
+}
+
+func TestThrow(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	for range 1000 {
+		throw := DefaultThrowModel.Throw(rng)
+		if throw.Roll != Nak && throw.Roll != RollFromSticks(throw.Sticks) {
+			t.Fatalf("got roll %d for sticks %v", throw.Roll, throw.Sticks)
+		}
+	}
+
+	// sticks that always land the same way always give the same roll
+	flat := ThrowModel{FlatProbabilities: [StickCount]float64{1, 1, 1, 1}}
+	round := ThrowModel{FlatProbabilities: [StickCount]float64{1, 0, 0, 0}}
+	nak := ThrowModel{FlatProbabilities: [StickCount]float64{1, 1, 1, 1}, NakProbability: 1}
+	for range 100 {
+		if roll := flat.Throw(rng).Roll; roll != Yut {
+			t.Fatalf("got roll %d want yut", roll)
+		}
+		if roll := round.Throw(rng).Roll; roll != Backdo {
+			t.Fatalf("got roll %d want backdo", roll)
+		}
+		if roll := nak.Throw(rng).Roll; roll != Nak {
+			t.Fatalf("got roll %d want nak", roll)
+		}
+	}
+}
+
+// The same seed gives the same throws, so a game can be replayed from its seed.
+func TestThrowSeeded(t *testing.T) {
+	throws := func(seed int64) []Throw {
+		rng := rand.New(rand.NewSource(seed))
+		throws := make([]Throw, 100)
+		for idx := range throws {
+			throws[idx] = DefaultThrowModel.Throw(rng)
+		}
+		return throws
+	}
+	first, again, other := throws(42), throws(42), throws(43)
+	if !slices.Equal(first, again) {
+		t.Errorf("the same seed gave different throws")
+	}
+	if slices.Equal(first, other) {
+		t.Errorf("different seeds gave the same throws")
+	}
+}
+
+func TestRollProbabilities(t *testing.T) {
+	models := []ThrowModel{
+		DefaultThrowModel,
+		{FlatProbabilities: [StickCount]float64{0.3, 0.5, 0.7, 0.9}, NakProbability: 0.1},
+	}
+	for _, m := range models {
+		total := 0.0
+		for _, p := range m.RollProbabilities() {
+			total += p
+		}
+		if math.Abs(total-1) > 1e-9 {
+			t.Errorf("%+v: the probabilities add up to %f", m, total)
+		}
+	}
+
+	flat := ThrowModel{FlatProbabilities: [StickCount]float64{1, 1, 1, 1}, NakProbability: 0.25}
+	want := [Mo - Backdo + 1]float64{}
+	want[Yut-Backdo] = 0.75
+	want[Nak-Backdo] = 0.25
+	if probs := flat.RollProbabilities(); probs != want {
+		t.Errorf("got %v want %v", probs, want)
+	}
+
+	// only the first stick is marked, so a single flat stick is a backdo
+	// only when it is that one
+	half := ThrowModel{FlatProbabilities: [StickCount]float64{0.5, 0.5, 0.5, 0.5}}
+	probs := half.RollProbabilities()
+	if probs[Backdo-Backdo] != 1.0/16 || probs[Do-Backdo] != 3.0/16 || probs[Gae-Backdo] != 6.0/16 || probs[Mo-Backdo] != 1.0/16 {
+		t.Errorf("got %v", probs)
+	}
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/AdventurerAmer/yutnori/bot"
+)
+
+// BotDelay is how long a bot waits before acting, so players can follow it.
+const BotDelay = 700 * time.Millisecond
+
+const MaxBotNameLength = 32
+
+// NewBotClient makes the client of a bot seat, it has no connection and
+// every message sent to it is dropped.
+func NewBotClient() *Client {
+	c := &Client{
+		ID:   ClientID(generateUUID()),
+		Bot:  true,
+		Done: make(chan struct{}),
+	}
+	close(c.Done)
+	return c
+}
+
+// playBot makes the current player act if it is a bot. The bot goes through
+// the same game actions as a client, after BotDelay.
+func (g *GameInstance) playBot(r *Room) {
+	player := g.CurrentPlayer()
+	if player.Client.BotMode() {
+		g.askBot(r)
+		return
+	}
+	if player.Bot == "" {
+		return
+	}
+	var action GameExecutor
+	switch g.GameState {
+	case GameStateCanRoll:
+		action = BeginRollGameAction{}
+	case GameStateSelectingMove:
+		strategy := bot.New(player.Bot, g.ThrowModel, g.BotRand)
+		action = BeginMoveGameAction{Move: strategy.ChooseMove(g.State)}
+	default:
+		return
+	}
+	client := player.Client
+	time.AfterFunc(BotDelay, func() {
+		r.ExecuteGameAction(client, action)
+	})
+}
+
+// askBot lets a client in bot mode play, the server rolls for it and asks it
+// for a move with the snapshot of the game. The answer is a BeginMove message
+// like any client's.
+func (g *GameInstance) askBot(r *Room) {
+	client := g.CurrentPlayer().Client
+	switch g.GameState {
+	case GameStateCanRoll:
+		go r.ExecuteGameAction(client, BeginRollGameAction{})
+	case GameStateSelectingMove:
+		client.Send(BotTurnResponse{Snapshot: g.Snapshot()})
+	}
+}
+
+// ackBotMoves acknowledges the current move for every bot client, bots have
+// nothing to animate.
+func (g *GameInstance) ackBotMoves() {
+	for _, p := range g.Players {
+		if p.Client.Bot || p.Client.BotMode() {
+			g.EndMoveSet[p.Client] = struct{}{}
+		}
+	}
+}
+
+type AddBotGameAction struct {
+	Difficulty bot.Difficulty
+	Name       string
+}
+
+func (a AddBotGameAction) Execute(c *Client, r *Room) {
+	instance := r.GameInstance
+	if instance.GameState != GameStateGameEnded || c != r.Master || len(instance.Players) == MaxPlayerCountInRoom {
+		c.Send(AddBotResponse{ShouldAdd: false})
+		return
+	}
+	name := a.Name
+	if name == "" {
+		name = fmt.Sprintf("Bot (%s)", a.Difficulty)
+	}
+	client := NewBotClient()
+	team := instance.SmallestTeam()
+	instance.Players = append(instance.Players, PlayerState{
+		Client:  client,
+		Name:    name,
+		IsReady: true,
+		Team:    team,
+		Bot:     a.Difficulty,
+	})
+	log.Printf("room '%s' added a %s bot '%s'\n", r.ID, a.Difficulty, client.ID)
+	err := r.Broadcast(PlayerJoinedResponse{ClientID: client.ID, Name: name, Team: team, Bot: a.Difficulty})
+	if err == nil {
+		err = r.Broadcast(PlayerReadyResponse{Player: client.ID, IsReady: true})
+	}
+	if err != nil {
+		log.Println(err)
+	}
+}
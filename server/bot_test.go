@@ -0,0 +1,101 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/AdventurerAmer/yutnori/bot"
+)
+
+func TestAddBot(t *testing.T) {
+	hub := newTestHub(t, Config{})
+	a, b := connect(t, hub, "a"), connect(t, hub, "b")
+	newRoom(t, a, b)
+
+	added := AddBotResponse{ShouldAdd: true}
+	b.send(MessageTypeAddBot, map[string]any{"difficulty": "easy"})
+	b.expect(MessageTypeAddBot, &added)
+	if added.ShouldAdd {
+		t.Error("a player who is not the master added a bot")
+	}
+	added.ShouldAdd = true
+	a.send(MessageTypeAddBot, map[string]any{"difficulty": "impossible"})
+	a.expect(MessageTypeAddBot, &added)
+	if added.ShouldAdd {
+		t.Error("added a bot of an unknown difficulty")
+	}
+
+	a.send(MessageTypeAddBot, map[string]any{"difficulty": "hard", "name": "robot"})
+	joined := PlayerJoinedResponse{}
+	b.expect(MessageTypePlayerJoined, &joined)
+	if joined.Bot != bot.Hard || joined.Name != "robot" {
+		t.Errorf("got %+v", joined)
+	}
+	ready := PlayerReadyResponse{}
+	b.expect(MessageTypePlayerReady, &ready)
+	if ready.Player != joined.ClientID || !ready.IsReady {
+		t.Errorf("got %+v", ready)
+	}
+
+	// the bot rolls on its own when its turn comes
+	startGame(t, a, b)
+	play(t, a, []*testClient{a, b}, func(msg Message) bool {
+		call := CallRollResponse{}
+		json.Unmarshal(msg.Payload, &call)
+		return msg.Kind == MessageTypeCanRoll && call.Player == joined.ClientID
+	})
+	a.expect(MessageTypeEndRoll, nil)
+}
+
+func botMode(c *testClient) BotModeResponse {
+	c.t.Helper()
+	c.send(MessageTypeBotMode, map[string]any{"name": c.Name})
+	resp := BotModeResponse{}
+	c.expect(MessageTypeBotMode, &resp)
+	return resp
+}
+
+func TestBotMode(t *testing.T) {
+	hub := newTestHub(t, Config{BotDeadline: time.Minute})
+	a, b := connect(t, hub, "a"), connect(t, hub, "b")
+	if resp := botMode(a); !resp.Enabled || resp.DeadlineMillis != time.Minute.Milliseconds() {
+		t.Errorf("got %+v", resp)
+	}
+	newRoom(t, a, b)
+	if resp := botMode(b); resp.Enabled {
+		t.Error("entered bot mode in a room")
+	}
+
+	// the server rolls for the bot and asks it for its moves
+	startGame(t, a, b)
+	asked := false
+	play(t, a, []*testClient{b}, func(msg Message) bool {
+		if msg.Kind == MessageTypeBotTurn {
+			turn := BotTurnResponse{}
+			decode(t, msg, &turn)
+			if turn.Snapshot.PlayerTurn != a.ID || len(turn.Snapshot.LegalMoves) == 0 {
+				t.Fatalf("got %+v", turn.Snapshot)
+			}
+			asked = true
+			a.send(MessageTypeBeginMove, turn.Snapshot.LegalMoves[0])
+		}
+		return msg.Kind == MessageTypeEndGame
+	})
+	if !asked {
+		t.Error("the bot was never asked for a move")
+	}
+}
+
+func TestBotDeadline(t *testing.T) {
+	hub := newTestHub(t, Config{BotDeadline: 50 * time.Millisecond})
+	a, b := connect(t, hub, "a"), connect(t, hub, "b")
+	botMode(a)
+	newRoom(t, a, b)
+	startGame(t, a, b)
+	timeout := TurnTimeoutResponse{}
+	decode(t, play(t, a, []*testClient{b}, is(MessageTypeTurnTimeout)), &timeout)
+	if timeout.Player != a.ID || timeout.Action != TimeoutAuto {
+		t.Errorf("got %+v", timeout)
+	}
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"bufio"
+	"log"
+	"os"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+const MaxChatMessageLength = 256
+const ChatHistorySize = 50
+
+// a client may send ChatBurst messages at once, then one every ChatInterval
+const ChatBurst = 5
+const ChatInterval = 2 * time.Second
+
+type chatLimiter struct {
+	tokens float64
+	last   time.Time
+}
+
+func (l *chatLimiter) Allow(now time.Time) bool {
+	if l.last.IsZero() {
+		l.tokens = ChatBurst
+	} else {
+		l.tokens += float64(now.Sub(l.last)) / float64(ChatInterval)
+		l.tokens = min(l.tokens, ChatBurst)
+	}
+	l.last = now
+	if l.tokens < 1 {
+		return false
+	}
+	l.tokens--
+	return true
+}
+
+// ChatFilter masks a list of words in chat messages, matching is case
+// insensitive and only whole words are masked.
+type ChatFilter struct {
+	re *regexp.Regexp
+}
+
+func NewChatFilter(words []string) *ChatFilter {
+	quoted := []string{}
+	for _, w := range words {
+		w = strings.TrimSpace(w)
+		if w == "" {
+			continue
+		}
+		quoted = append(quoted, regexp.QuoteMeta(w))
+	}
+	if len(quoted) == 0 {
+		return nil
+	}
+	return &ChatFilter{re: regexp.MustCompile(`(?i)\b(` + strings.Join(quoted, "|") + `)\b`)}
+}
+
+// LoadChatFilter reads one word per line, lines starting with '#' are
+// ignored. An empty path means no filter.
+func LoadChatFilter(path string) (*ChatFilter, error) {
+	if path == "" {
+		return nil, nil
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	words := []string{}
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if strings.HasPrefix(line, "#") {
+			continue
+		}
+		words = append(words, line)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return NewChatFilter(words), nil
+}
+
+func (f *ChatFilter) Censor(text string) string {
+	if f == nil {
+		return text
+	}
+	return f.re.ReplaceAllStringFunc(text, func(w string) string {
+		return strings.Repeat("*", utf8.RuneCountInString(w))
+	})
+}
+
+// cleanChatText trims the message and reports whether it can be sent.
+func cleanChatText(text string) (string, bool) {
+	text = strings.TrimSpace(text)
+	if text == "" || !utf8.ValidString(text) || utf8.RuneCountInString(text) > MaxChatMessageLength {
+		return text, false
+	}
+	return text, true
+}
+
+// ChatGameAction sends a message to the whole room, or to a single member of
+// the room when To is set. Direct messages are not kept in the history.
+type ChatGameAction struct {
+	Text string
+	To   ClientID
+}
+
+func (ch ChatGameAction) Execute(c *Client, r *Room) {
+	_, name := r.FindMember(c.ID)
+	msg := ChatResponse{
+		Sent: true,
+		From: c.ID,
+		Name: name,
+		To:   ch.To,
+		Text: r.ChatFilter.Censor(ch.Text),
+		Time: time.Now().Unix(),
+	}
+	if ch.To == "" {
+		r.ChatHistory = append(r.ChatHistory, msg)
+		if len(r.ChatHistory) > ChatHistorySize {
+			r.ChatHistory = slices.Delete(r.ChatHistory, 0, len(r.ChatHistory)-ChatHistorySize)
+		}
+		err := r.Broadcast(msg)
+		if err != nil {
+			log.Println(err)
+		}
+		return
+	}
+	recipient, _ := r.FindMember(ch.To)
+	if recipient == nil || recipient == c {
+		c.Send(ChatResponse{Reason: "unknown recipient"})
+		return
+	}
+	recipient.Send(msg)
+	c.Send(msg)
+}
+
+func (ch ChatGameAction) SpectatorAllowed() bool {
+	return true
+}
@@ -0,0 +1,191 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestChatLimiter(t *testing.T) {
+	l := chatLimiter{}
+	now := time.Now()
+	for idx := range ChatBurst {
+		if !l.Allow(now) {
+			t.Fatalf("message %d of the burst was limited", idx)
+		}
+	}
+	if l.Allow(now) {
+		t.Error("allowed a message past the burst")
+	}
+	now = now.Add(ChatInterval)
+	if !l.Allow(now) || l.Allow(now) {
+		t.Error("one message should be allowed after an interval")
+	}
+	now = now.Add(10 * ChatBurst * ChatInterval)
+	for idx := range ChatBurst {
+		if !l.Allow(now) {
+			t.Fatalf("message %d of the refilled burst was limited", idx)
+		}
+	}
+	if l.Allow(now) {
+		t.Error("the burst refilled past its size")
+	}
+}
+
+func TestChatFilter(t *testing.T) {
+	f := NewChatFilter([]string{"darn", " heck ", "", "a.b"})
+	tests := []struct {
+		text string
+		want string
+	}{
+		{"darn it", "**** it"},
+		{"DARN, Heck!", "****, ****!"},
+		{"darned", "darned"},
+		{"a.b axb", "*** axb"},
+		{"clean", "clean"},
+	}
+	for _, test := range tests {
+		if got := f.Censor(test.text); got != test.want {
+			t.Errorf("%q: got %q want %q", test.text, got, test.want)
+		}
+	}
+	var none *ChatFilter
+	if got := none.Censor("darn"); got != "darn" {
+		t.Errorf("no filter changed the text to %q", got)
+	}
+	if NewChatFilter([]string{" ", ""}) != nil {
+		t.Error("no words gave a filter")
+	}
+}
+
+func TestLoadChatFilter(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "words")
+	err := os.WriteFile(path, []byte("# comment\ndarn\n\nheck\n"), 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f, err := LoadChatFilter(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := f.Censor("darn heck comment"); got != "**** **** comment" {
+		t.Errorf("got %q", got)
+	}
+	f, err = LoadChatFilter("")
+	if f != nil || err != nil {
+		t.Errorf("an empty path gave %v, %v", f, err)
+	}
+	_, err = LoadChatFilter(filepath.Join(t.TempDir(), "missing"))
+	if err == nil {
+		t.Error("loaded a missing file")
+	}
+}
+
+func TestCleanChatText(t *testing.T) {
+	tests := []struct {
+		text string
+		want string
+		ok   bool
+	}{
+		{"  hello  ", "hello", true},
+		{"", "", false},
+		{" \t\n", "", false},
+		{"\xff", "\xff", false},
+		{strings.Repeat("가", MaxChatMessageLength), strings.Repeat("가", MaxChatMessageLength), true},
+		{strings.Repeat("a", MaxChatMessageLength+1), strings.Repeat("a", MaxChatMessageLength+1), false},
+	}
+	for _, test := range tests {
+		got, ok := cleanChatText(test.text)
+		if got != test.want || ok != test.ok {
+			t.Errorf("%q: got %q, %v", test.text, got, ok)
+		}
+	}
+}
+
+func TestChat(t *testing.T) {
+	hub := newTestHub(t, Config{ChatFilter: NewChatFilter([]string{"darn"})})
+	a, b, c := connect(t, hub, "a"), connect(t, hub, "b"), connect(t, hub, "c")
+	room := newRoom(t, a, b)
+
+	a.send(MessageTypeChat, map[string]any{"text": " darn hello "})
+	for _, client := range []*testClient{a, b} {
+		msg := ChatResponse{}
+		client.expect(MessageTypeChat, &msg)
+		if !msg.Sent || msg.From != a.ID || msg.Name != "a" || msg.Text != "**** hello" || msg.To != "" {
+			t.Errorf("%s got %+v", client.Name, msg)
+		}
+	}
+
+	b.send(MessageTypeChat, map[string]any{"text": "psst", "to": a.ID})
+	for _, client := range []*testClient{a, b} {
+		msg := ChatResponse{}
+		client.expect(MessageTypeChat, &msg)
+		if !msg.Sent || msg.From != b.ID || msg.To != a.ID || msg.Text != "psst" {
+			t.Errorf("%s got %+v", client.Name, msg)
+		}
+	}
+
+	failures := []struct {
+		name    string
+		payload map[string]any
+		reason  string
+	}{
+		{"empty", map[string]any{"text": " "}, "invalid message"},
+		{"unknown recipient", map[string]any{"text": "hi", "to": "nobody"}, "unknown recipient"},
+		{"to self", map[string]any{"text": "hi", "to": b.ID}, "unknown recipient"},
+	}
+	for _, test := range failures {
+		b.send(MessageTypeChat, test.payload)
+		msg := ChatResponse{}
+		b.expect(MessageTypeChat, &msg)
+		if msg.Sent || msg.Reason != test.reason {
+			t.Errorf("%s: got %+v", test.name, msg)
+		}
+	}
+
+	// only the messages to the whole room are kept for the ones joining later
+	c.send(MessageTypeEnterRoom, map[string]any{"room_id": room, "name": "c"})
+	history := ChatHistoryResponse{}
+	c.expect(MessageTypeChatHistory, &history)
+	if len(history.Messages) != 1 || history.Messages[0].Text != "**** hello" {
+		t.Errorf("got history %+v", history.Messages)
+	}
+}
+
+func TestChatOutsideRoom(t *testing.T) {
+	hub := newTestHub(t, Config{})
+	a := connect(t, hub, "a")
+	a.send(MessageTypeChat, map[string]any{"text": "hello"})
+	msg := ChatResponse{}
+	a.expect(MessageTypeChat, &msg)
+	if msg.Sent || msg.Reason != "not in a room" {
+		t.Errorf("got %+v", msg)
+	}
+}
+
+func TestChatRateLimited(t *testing.T) {
+	hub := newTestHub(t, Config{})
+	a, b := connect(t, hub, "a"), connect(t, hub, "b")
+	newRoom(t, a, b)
+	for range ChatBurst {
+		a.send(MessageTypeChat, map[string]any{"text": "spam"})
+	}
+	a.send(MessageTypeChat, map[string]any{"text": "spam"})
+	// the refusal is sent right away so it may come before the messages
+	// the room sends
+	sent, limited := 0, 0
+	for range ChatBurst + 1 {
+		msg := ChatResponse{}
+		a.expect(MessageTypeChat, &msg)
+		if msg.Sent {
+			sent++
+		} else if msg.Reason == "rate limited" {
+			limited++
+		}
+	}
+	if sent != ChatBurst || limited != 1 {
+		t.Errorf("got %d sent and %d limited", sent, limited)
+	}
+}
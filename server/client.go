@@ -6,17 +6,43 @@ import (
 	"net"
 	"sync"
 	"time"
+	"unicode/utf8"
+
+	"github.com/AdventurerAmer/yutnori/bot"
+	"github.com/AdventurerAmer/yutnori/rating"
+	"github.com/AdventurerAmer/yutnori/rules"
 )
 
+const MaxRatingQueryCount = 50
+const MaxIdentityNameLength = 32
+
+// MaxIdentitiesPerHost bounds the identities the connections from one host can
+// create, so a client cannot fill the rating store by reconnecting.
+const MaxIdentitiesPerHost = 3
+
 type ClientID string
 
 type Client struct {
-	Conn   net.Conn
-	ID     ClientID
-	SendCh chan []byte
+	Conn         net.Conn
+	ID           ClientID
+	SessionToken string
+	SendCh       chan []byte
+	Bot          bool // bot clients have no connection, see NewBotClient
 
 	EnterRoomCh chan *Room
 	ExitRoomCh  chan struct{}
+	Done        chan struct{} // closed once the client's write loop returns
+
+	replaced     chan struct{} // closed once another connection took the seat over
+	replacedOnce sync.Once
+
+	chat chatLimiter // only used by the client's read loop
+
+	identityMu sync.Mutex
+	identity   string // player ID of the rating store, empty until identified
+
+	botModeMu sync.Mutex
+	botMode   bool // the client is an external bot, see docs/bot-protocol.md
 
 	roomMu sync.RWMutex
 	room   *Room // don't read or write this outside of the client's read/write loop
@@ -24,20 +50,84 @@ type Client struct {
 
 func NewClient(conn net.Conn) *Client {
 	return &Client{
-		Conn:        conn,
-		ID:          ClientID(generateUUID()),
-		SendCh:      make(chan []byte, 128),
-		EnterRoomCh: make(chan *Room),
-		ExitRoomCh:  make(chan struct{}),
+		Conn:         conn,
+		ID:           ClientID(generateUUID()),
+		SessionToken: generateUUID(),
+		SendCh:       make(chan []byte, 128),
+		EnterRoomCh:  make(chan *Room),
+		ExitRoomCh:   make(chan struct{}),
+		Done:         make(chan struct{}),
+		replaced:     make(chan struct{}),
 	}
 }
 
-func (c *Client) EnterRoom(room *Room) {
-	c.EnterRoomCh <- room
+// Replace stops the write loop of a client whose seat a reconnecting client
+// took over. The room and the session now belong to the new client, so the
+// loop returns without leaving them.
+func (c *Client) Replace() {
+	c.replacedOnce.Do(func() {
+		close(c.replaced)
+	})
+}
+
+func (c *Client) isReplaced() bool {
+	select {
+	case <-c.replaced:
+		return true
+	default:
+		return false
+	}
+}
+
+// EnterRoom reports false when the client is already gone.
+func (c *Client) EnterRoom(room *Room) bool {
+	select {
+	case c.EnterRoomCh <- room:
+		return true
+	case <-c.Done:
+		return false
+	}
 }
 
 func (c *Client) ExitRoom() {
-	c.ExitRoomCh <- struct{}{}
+	select {
+	case c.ExitRoomCh <- struct{}{}:
+	case <-c.Done:
+	}
+}
+
+func (c *Client) Identity() string {
+	c.identityMu.Lock()
+	defer c.identityMu.Unlock()
+	return c.identity
+}
+
+func (c *Client) SetIdentity(identity string) {
+	c.identityMu.Lock()
+	defer c.identityMu.Unlock()
+	c.identity = identity
+}
+
+// BotMode is read by the room while the client's read loop may switch it on.
+func (c *Client) BotMode() bool {
+	c.botModeMu.Lock()
+	defer c.botModeMu.Unlock()
+	return c.botMode
+}
+
+func (c *Client) SetBotMode(botMode bool) {
+	c.botModeMu.Lock()
+	defer c.botModeMu.Unlock()
+	c.botMode = botMode
+}
+
+func (c *Client) IsDone() bool {
+	select {
+	case <-c.Done:
+		return true
+	default:
+		return false
+	}
 }
 
 func setRoom(c *Client, room *Room) {
@@ -62,6 +152,9 @@ func (c *Client) Send(msg MessageSerializer) error {
 }
 
 func (c *Client) SendBytes(msg []byte) {
+	if c.Bot {
+		return
+	}
 	c.SendCh <- msg
 }
 
@@ -70,7 +163,10 @@ func (c *Client) ReadLoop(hub *Hub) {
 		c.Conn.Close()
 		room := getRoom(c)
 		if room != nil {
-			room.Exit(c.ID, false)
+			room.Disconnect(c)
+		} else {
+			hub.LeaveQueue(c)
+			hub.EndClientSession(c)
 		}
 	}()
 
@@ -86,10 +182,17 @@ func (c *Client) ReadLoop(hub *Hub) {
 
 func (c *Client) WriteLoop(hub *Hub) {
 	defer func() {
+		close(c.Done)
 		c.Conn.Close()
+		if c.isReplaced() {
+			return
+		}
 		room := getRoom(c)
 		if room != nil {
-			room.Exit(c.ID, false)
+			room.Disconnect(c)
+		} else {
+			hub.LeaveQueue(c)
+			hub.EndClientSession(c)
 		}
 	}()
 	timer := time.NewTimer(time.Minute)
@@ -108,6 +211,8 @@ func (c *Client) WriteLoop(hub *Hub) {
 			setRoom(c, room)
 		case <-c.ExitRoomCh:
 			setRoom(c, nil)
+		case <-c.replaced:
+			return
 		case <-timer.C:
 			msg, err := SerializeMessage(KeepAliveMessage{})
 			if err != nil {
@@ -127,20 +232,43 @@ func handleMessage(c *Client, hub *Hub, msg Message) {
 	switch msg.Kind {
 	case MessageTypeCreateRoom:
 		req := struct {
-			Name string `json:"name"`
+			Name     string `json:"name"`
+			Password string `json:"password"`
+		}{}
+		err := json.Unmarshal(msg.Payload, &req)
+		if err != nil {
+			log.Println(err)
+			return
+		}
+		if len(req.Password) > MaxRoomPasswordLength {
+			req.Password = req.Password[:MaxRoomPasswordLength]
+		}
+		hub.CreateRoom(c, req.Name, req.Password)
+	case MessageTypeReconnect:
+		req := struct {
+			SessionToken string `json:"session_token"`
 		}{}
 		err := json.Unmarshal(msg.Payload, &req)
 		if err != nil {
 			log.Println(err)
 			return
 		}
-		hub.CreateRoom(c, req.Name)
+		session := hub.FindSession(req.SessionToken)
+		if session == nil || session == c || getRoom(c) != nil {
+			c.Send(ReconnectResponse{})
+			break
+		}
+		// the hub must be done with the client before it takes the session over
+		hub.LeaveQueue(c)
+		if !getRoom(session).Reconnect(c, session) {
+			c.Send(ReconnectResponse{})
+		}
 	case MessageTypeExitRoom:
 		room := getRoom(c)
 		if room == nil {
 			break
 		}
-		room.Exit(c.ID, false)
+		room.Exit(c.ID)
 	case MessageTypeSetPieceCount:
 		req := struct {
 			PieceCount uint8 `json:"piece_count"`
@@ -163,17 +291,128 @@ func handleMessage(c *Client, hub *Hub, msg Message) {
 			break
 		}
 		room.ExecuteGameAction(c, SetPieceCountGameAction{PieceCount: pieceCount})
+	case MessageTypeSetRuleSet:
+		req := struct {
+			Rules rules.RuleSet `json:"rules"`
+		}{}
+		err := json.Unmarshal(msg.Payload, &req)
+		if err != nil {
+			log.Println(err)
+			return
+		}
+		if req.Rules.MaxBonusThrows < 0 {
+			req.Rules.MaxBonusThrows = 0
+		}
+		room := getRoom(c)
+		if room == nil {
+			c.Send(SetRuleSetResponse{})
+			break
+		}
+		room.ExecuteGameAction(c, SetRuleSetGameAction{Rules: req.Rules})
+	case MessageTypeSetThrowModel:
+		req := struct {
+			ThrowModel rules.ThrowModel `json:"throw_model"`
+		}{}
+		err := json.Unmarshal(msg.Payload, &req)
+		if err != nil {
+			log.Println(err)
+			return
+		}
+		room := getRoom(c)
+		if room == nil {
+			c.Send(SetThrowModelResponse{})
+			break
+		}
+		room.ExecuteGameAction(c, SetThrowModelGameAction{ThrowModel: req.ThrowModel.Clamped()})
+	case MessageTypeSetFairMode:
+		req := struct {
+			Fair bool `json:"fair"`
+		}{}
+		err := json.Unmarshal(msg.Payload, &req)
+		if err != nil {
+			log.Println(err)
+			return
+		}
+		room := getRoom(c)
+		if room == nil {
+			c.Send(SetFairModeResponse{})
+			break
+		}
+		room.ExecuteGameAction(c, SetFairModeGameAction{Fair: req.Fair})
+	case MessageTypeContributeEntropy:
+		req := struct {
+			Entropy string `json:"entropy"`
+		}{}
+		err := json.Unmarshal(msg.Payload, &req)
+		if err != nil {
+			log.Println(err)
+			return
+		}
+		room := getRoom(c)
+		if room == nil {
+			c.Send(ContributeEntropyResponse{})
+			break
+		}
+		room.ExecuteGameAction(c, ContributeEntropyGameAction{Entropy: req.Entropy})
+	case MessageTypeSetTeamCount:
+		req := struct {
+			TeamCount uint8 `json:"team_count"`
+		}{}
+		err := json.Unmarshal(msg.Payload, &req)
+		if err != nil {
+			log.Println(err)
+			return
+		}
+		teamCount := req.TeamCount
+		if teamCount > MaxTeamCountInRoom {
+			teamCount = MaxTeamCountInRoom
+		}
+		if teamCount != 0 && teamCount < MinTeamCountInRoom {
+			teamCount = MinTeamCountInRoom
+		}
+		room := getRoom(c)
+		if room == nil {
+			c.Send(SetTeamCountResponse{})
+			break
+		}
+		room.ExecuteGameAction(c, SetTeamCountGameAction{TeamCount: teamCount})
+	case MessageTypeSetTeam:
+		req := struct {
+			Player ClientID `json:"player"`
+			Team   int      `json:"team"`
+		}{}
+		err := json.Unmarshal(msg.Payload, &req)
+		if err != nil {
+			log.Println(err)
+			return
+		}
+		room := getRoom(c)
+		if room == nil {
+			c.Send(SetTeamResponse{})
+			break
+		}
+		room.ExecuteGameAction(c, SetTeamGameAction{Player: req.Player, Team: req.Team})
 	case MessageTypeEnterRoom:
 		req := struct {
-			RoomID RoomID `json:"room_id"`
-			Name   string `json:"name"`
+			RoomID     RoomID `json:"room_id"`
+			InviteCode string `json:"invite_code"`
+			Name       string `json:"name"`
+			Password   string `json:"password"`
+			Spectate   bool   `json:"spectate"`
 		}{}
 		err := json.Unmarshal(msg.Payload, &req)
 		if err != nil {
 			log.Println(err)
 			return
 		}
-		hub.EnterRoom(c, req.Name, req.RoomID)
+		hub.EnterRoom(EnterRoomParams{
+			Client:     c,
+			ClientName: req.Name,
+			Room:       req.RoomID,
+			InviteCode: req.InviteCode,
+			Password:   req.Password,
+			Spectate:   req.Spectate,
+		})
 	case MessageTypePlayerReady:
 		req := struct {
 			IsReady bool `json:"is_ready"`
@@ -203,7 +442,7 @@ func handleMessage(c *Client, hub *Hub, msg Message) {
 			c.Send(PlayerJoinedResponse{})
 			break
 		}
-		room.Exit(req.Player, true)
+		room.Kick(c, req.Player)
 	case MessageTypeStartGame:
 		room := getRoom(c)
 		if room == nil {
@@ -219,9 +458,10 @@ func handleMessage(c *Client, hub *Hub, msg Message) {
 		room.ExecuteGameAction(c, BeginRollGameAction{})
 	case MessageTypeBeginMove:
 		req := struct {
-			Roll  int    `json:"roll"`
-			Cell  CellID `json:"cell"`
-			Piece int    `json:"piece"`
+			Roll  int          `json:"roll"`
+			Cell  rules.CellID `json:"cell"`
+			Piece int          `json:"piece"`
+			Outer bool         `json:"outer"`
 		}{}
 		err := json.Unmarshal(msg.Payload, &req)
 		if err != nil {
@@ -233,17 +473,19 @@ func handleMessage(c *Client, hub *Hub, msg Message) {
 			break
 		}
 		room.ExecuteGameAction(c, BeginMoveGameAction{
-			Move: Move{
+			Move: rules.Move{
 				Roll:  req.Roll,
 				Cell:  req.Cell,
 				Piece: req.Piece,
+				Outer: req.Outer,
 			},
 		})
 	case MessageTypeEndMove:
 		req := struct {
-			Roll  int    `json:"roll"`
-			Cell  CellID `json:"cell"`
-			Piece int    `json:"piece"`
+			Roll  int          `json:"roll"`
+			Cell  rules.CellID `json:"cell"`
+			Piece int          `json:"piece"`
+			Outer bool         `json:"outer"`
 		}{}
 		err := json.Unmarshal(msg.Payload, &req)
 		if err != nil {
@@ -255,10 +497,11 @@ func handleMessage(c *Client, hub *Hub, msg Message) {
 			break
 		}
 		room.ExecuteGameAction(c, EndMoveGameAction{
-			Move: Move{
+			Move: rules.Move{
 				Roll:  req.Roll,
 				Cell:  req.Cell,
 				Piece: req.Piece,
+				Outer: req.Outer,
 			},
 		})
 	case MessageTypeChangeName:
@@ -276,6 +519,286 @@ func handleMessage(c *Client, hub *Hub, msg Message) {
 		}
 		room.ExecuteGameAction(c, ChangeNameGameAction{Name: req.Name})
 		log.Println(req)
+	case MessageTypeGameSnapshot:
+		room := getRoom(c)
+		if room == nil {
+			c.Send(GameSnapshot{GameState: GameStateGameEnded, WinningTeam: -1})
+			break
+		}
+		room.ExecuteGameAction(c, GameSnapshotGameAction{})
+	case MessageTypeWinProbability:
+		room := getRoom(c)
+		if room == nil {
+			c.Send(WinProbabilityResponse{Players: []PlayerWinProbability{}})
+			break
+		}
+		room.ExecuteGameAction(c, WinProbabilityGameAction{})
+	case MessageTypeChat:
+		req := struct {
+			Text string   `json:"text"`
+			To   ClientID `json:"to"`
+		}{}
+		err := json.Unmarshal(msg.Payload, &req)
+		if err != nil {
+			log.Println(err)
+			return
+		}
+		room := getRoom(c)
+		if room == nil {
+			c.Send(ChatResponse{Reason: "not in a room"})
+			break
+		}
+		text, ok := cleanChatText(req.Text)
+		if !ok {
+			c.Send(ChatResponse{Reason: "invalid message"})
+			break
+		}
+		if !c.chat.Allow(time.Now()) {
+			c.Send(ChatResponse{Reason: "rate limited"})
+			break
+		}
+		room.ExecuteGameAction(c, ChatGameAction{Text: text, To: req.To})
+	case MessageTypeIdentify:
+		req := struct {
+			Token string `json:"token"`
+			Name  string `json:"name"`
+		}{}
+		err := json.Unmarshal(msg.Payload, &req)
+		if err != nil {
+			log.Println(err)
+			return
+		}
+		store := hub.Config.Ratings
+		if store == nil {
+			c.Send(IdentifyResponse{})
+			break
+		}
+		var player rating.Player
+		token := ""
+		if req.Token == "" {
+			if !hub.AllowIdentity(c.Conn) {
+				c.Send(IdentifyResponse{})
+				break
+			}
+			if utf8.RuneCountInString(req.Name) > MaxIdentityNameLength {
+				req.Name = string([]rune(req.Name)[:MaxIdentityNameLength])
+			}
+			player, token, err = store.Create(req.Name)
+		} else {
+			player, err = store.Authenticate(req.Token)
+		}
+		if err != nil {
+			log.Println(err)
+			c.Send(IdentifyResponse{})
+			break
+		}
+		c.SetIdentity(player.ID)
+		c.Send(IdentifyResponse{
+			Identified: true,
+			PlayerID:   player.ID,
+			Token:      token,
+			Name:       player.Name,
+			Rating:     player.Rating,
+			Games:      player.Games,
+			Wins:       player.Wins,
+		})
+	case MessageTypeRating:
+		req := struct {
+			Players []string `json:"players"`
+		}{}
+		err := json.Unmarshal(msg.Payload, &req)
+		if err != nil {
+			log.Println(err)
+			return
+		}
+		response := RatingResponse{Players: []PlayerRating{}}
+		store := hub.Config.Ratings
+		if store == nil {
+			c.Send(response)
+			break
+		}
+		if len(req.Players) == 0 && c.Identity() != "" {
+			req.Players = []string{c.Identity()}
+		}
+		for _, id := range req.Players[:min(len(req.Players), MaxRatingQueryCount)] {
+			player, ok := store.Get(id)
+			if ok {
+				response.Players = append(response.Players, playerRating(player))
+			}
+		}
+		c.Send(response)
+	case MessageTypeJoinQueue:
+		req := struct {
+			Name        string        `json:"name"`
+			PlayerCount int           `json:"player_count"`
+			PieceCount  uint8         `json:"piece_count"`
+			Rules       rules.RuleSet `json:"rules"`
+		}{}
+		err := json.Unmarshal(msg.Payload, &req)
+		if err != nil {
+			log.Println(err)
+			return
+		}
+		if getRoom(c) != nil {
+			c.Send(QueueStatusResponse{})
+			break
+		}
+		playerCount := min(max(req.PlayerCount, MinPlayerCountToStartGame), MaxPlayerCountInRoom)
+		pieceCount := min(max(req.PieceCount, MinPieceCountInRoom), MaxPieceCountInRoom)
+		if req.Rules.MaxBonusThrows < 0 {
+			req.Rules.MaxBonusThrows = 0
+		}
+		hub.JoinQueue(c, req.Name, QueuePreferences{
+			PlayerCount: playerCount,
+			PieceCount:  pieceCount,
+			Rules:       req.Rules,
+		})
+	case MessageTypeLeaveQueue:
+		hub.LeaveQueue(c)
+	case MessageTypeListRooms:
+		req := struct {
+			State      string `json:"state"`
+			PieceCount uint8  `json:"piece_count"`
+			NotFull    bool   `json:"not_full"`
+			Master     string `json:"master"`
+			NoBots     bool   `json:"no_bots"`
+			Page       int    `json:"page"`
+			PageSize   int    `json:"page_size"`
+		}{}
+		err := json.Unmarshal(msg.Payload, &req)
+		if err != nil {
+			log.Println(err)
+			return
+		}
+		pageSize := req.PageSize
+		if pageSize <= 0 {
+			pageSize = DefaultRoomPageSize
+		}
+		if pageSize > MaxRoomPageSize {
+			pageSize = MaxRoomPageSize
+		}
+		hub.ListRooms(c, RoomFilter{
+			State:      req.State,
+			PieceCount: req.PieceCount,
+			NotFull:    req.NotFull,
+			Master:     req.Master,
+			NoBots:     req.NoBots,
+			Page:       max(req.Page, 0),
+			PageSize:   pageSize,
+		})
+	case MessageTypeSetPassword:
+		req := struct {
+			Password string `json:"password"`
+		}{}
+		err := json.Unmarshal(msg.Payload, &req)
+		if err != nil {
+			log.Println(err)
+			return
+		}
+		room := getRoom(c)
+		if room == nil {
+			c.Send(SetPasswordResponse{})
+			break
+		}
+		if len(req.Password) > MaxRoomPasswordLength {
+			req.Password = req.Password[:MaxRoomPasswordLength]
+		}
+		room.ExecuteGameAction(c, SetPasswordGameAction{Password: req.Password})
+	case MessageTypeSetTimeControl:
+		req := TimeControl{}
+		err := json.Unmarshal(msg.Payload, &req)
+		if err != nil {
+			log.Println(err)
+			return
+		}
+		room := getRoom(c)
+		if room == nil {
+			c.Send(SetTimeControlResponse{})
+			break
+		}
+		room.ExecuteGameAction(c, SetTimeControlGameAction{TimeControl: req.Clamped()})
+	case MessageTypeSetVisibility:
+		req := struct {
+			Public bool `json:"public"`
+		}{}
+		err := json.Unmarshal(msg.Payload, &req)
+		if err != nil {
+			log.Println(err)
+			return
+		}
+		room := getRoom(c)
+		if room == nil {
+			c.Send(SetVisibilityResponse{})
+			break
+		}
+		room.ExecuteGameAction(c, SetVisibilityGameAction{Public: req.Public})
+	case MessageTypePromoteSpectator:
+		req := struct {
+			Spectator ClientID `json:"spectator"`
+		}{}
+		err := json.Unmarshal(msg.Payload, &req)
+		if err != nil {
+			log.Println(err)
+			return
+		}
+		room := getRoom(c)
+		if room == nil {
+			c.Send(PromoteSpectatorResponse{})
+			break
+		}
+		room.ExecuteGameAction(c, PromoteSpectatorGameAction{Spectator: req.Spectator})
+	case MessageTypeAddBot:
+		req := struct {
+			Difficulty string `json:"difficulty"`
+			Name       string `json:"name"`
+		}{}
+		err := json.Unmarshal(msg.Payload, &req)
+		if err != nil {
+			log.Println(err)
+			return
+		}
+		room := getRoom(c)
+		difficulty, ok := bot.ParseDifficulty(req.Difficulty)
+		if room == nil || !ok {
+			c.Send(AddBotResponse{})
+			break
+		}
+		if len(req.Name) > MaxBotNameLength {
+			req.Name = req.Name[:MaxBotNameLength]
+		}
+		room.ExecuteGameAction(c, AddBotGameAction{Difficulty: difficulty, Name: req.Name})
+	case MessageTypeBotMode:
+		req := struct {
+			Name string `json:"name"`
+		}{}
+		err := json.Unmarshal(msg.Payload, &req)
+		if err != nil {
+			log.Println(err)
+			return
+		}
+		if getRoom(c) != nil {
+			c.Send(BotModeResponse{})
+			break
+		}
+		c.SetBotMode(true)
+		log.Printf("client '%s' is a bot named '%s'\n", c.ID, req.Name)
+		c.Send(BotModeResponse{Enabled: true, DeadlineMillis: hub.Config.BotDeadline.Milliseconds()})
+	case MessageTypeSetLeaveAction:
+		req := struct {
+			LeaveAction string `json:"leave_action"`
+		}{}
+		err := json.Unmarshal(msg.Payload, &req)
+		if err != nil {
+			log.Println(err)
+			return
+		}
+		room := getRoom(c)
+		action, ok := ParseLeaveAction(req.LeaveAction)
+		if room == nil || !ok {
+			c.Send(SetLeaveActionResponse{})
+			break
+		}
+		room.ExecuteGameAction(c, SetLeaveActionGameAction{LeaveAction: action})
 	}
 }
 
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"log"
+	"math/rand"
+	"slices"
+
+	"github.com/AdventurerAmer/yutnori/bot"
+	"github.com/AdventurerAmer/yutnori/replay"
+)
+
+// WinEstimate is the win probability of every team at a position, a position
+// is a game and the number of events in its replay.
+type WinEstimate struct {
+	Replay        *replay.Replay
+	Position      int
+	Probabilities []float64
+	Err           error
+}
+
+func (g *GameInstance) isEstimateCurrent(e WinEstimate) bool {
+	return e.Replay != nil && e.Replay == g.Replay && e.Position == len(g.Replay.Events)
+}
+
+// startEstimate plays the current position out on its own goroutine, so the
+// room keeps running meanwhile. Only one estimate runs at a time.
+func (g *GameInstance) startEstimate(r *Room) {
+	g.estimating = true
+	e := WinEstimate{Replay: g.Replay, Position: len(g.Replay.Events)}
+	s := g.State.Clone()
+	model := g.ThrowModel
+	rng := rand.New(rand.NewSource(g.BotRand.Int63()))
+	go func() {
+		e.Probabilities, e.Err = bot.WinProbabilities(s, bot.EstimatePlayouts, model, rng)
+		r.EstimateDone(e)
+	}()
+}
+
+// finishEstimate answers the clients waiting for an estimate. When the game
+// moved on in the meantime they still get it, marked as stale, as the game
+// may move on faster than positions can be estimated.
+func (g *GameInstance) finishEstimate(r *Room, e WinEstimate) {
+	g.estimating = false
+	if e.Err != nil {
+		log.Println(e.Err)
+	} else if e.Replay == g.Replay {
+		g.estimate = e
+	}
+	for _, c := range g.estimateWaiters {
+		if r.IsSpectator(c) {
+			c.Send(g.winProbabilityResponse())
+		}
+	}
+	g.estimateWaiters = nil
+}
+
+func (g *GameInstance) winProbabilityResponse() WinProbabilityResponse {
+	res := WinProbabilityResponse{Players: []PlayerWinProbability{}}
+	if g.GameState == GameStateGameEnded || g.State == nil || g.estimate.Replay != g.Replay {
+		return res
+	}
+	res.Playouts = bot.EstimatePlayouts
+	res.Position = g.estimate.Position
+	res.Stale = !g.isEstimateCurrent(g.estimate)
+	for idx, p := range g.Players {
+		team := g.State.Players[idx].Team
+		res.Players = append(res.Players, PlayerWinProbability{
+			Player:      p.Client.ID,
+			Team:        team,
+			Probability: g.estimate.Probabilities[team],
+		})
+	}
+	return res
+}
+
+// WinProbabilityGameAction estimates who is ahead for a spectator, players
+// are not told while they play.
+type WinProbabilityGameAction struct{}
+
+func (wp WinProbabilityGameAction) Execute(c *Client, r *Room) {
+	g := r.GameInstance
+	if !r.IsSpectator(c) || g.GameState == GameStateGameEnded || g.State == nil {
+		c.Send(WinProbabilityResponse{Players: []PlayerWinProbability{}})
+		return
+	}
+	if g.isEstimateCurrent(g.estimate) {
+		c.Send(g.winProbabilityResponse())
+		return
+	}
+	if !slices.Contains(g.estimateWaiters, c) {
+		g.estimateWaiters = append(g.estimateWaiters, c)
+	}
+	if !g.estimating {
+		g.startEstimate(r)
+	}
+}
+
+func (wp WinProbabilityGameAction) SpectatorAllowed() bool {
+	return true
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"math"
+	"testing"
+
+	"github.com/AdventurerAmer/yutnori/bot"
+)
+
+func TestWinProbability(t *testing.T) {
+	hub := newTestHub(t, Config{})
+	a, b, s := connect(t, hub, "a"), connect(t, hub, "b"), connect(t, hub, "s")
+	room := newRoom(t, a, b)
+	spectateRoom(t, s, room)
+
+	resp := WinProbabilityResponse{}
+	s.send(MessageTypeWinProbability, nil)
+	s.expect(MessageTypeWinProbability, &resp)
+	if len(resp.Players) != 0 {
+		t.Errorf("estimated a game that did not start: %+v", resp)
+	}
+
+	first := startGame(t, a, b)
+	// players are not told while they play
+	a.send(MessageTypeWinProbability, nil)
+	a.expect(MessageTypeWinProbability, &resp)
+	if len(resp.Players) != 0 {
+		t.Errorf("a player got an estimate: %+v", resp)
+	}
+	s.send(MessageTypeWinProbability, nil)
+	s.expect(MessageTypeWinProbability, &resp)
+	total := 0.0
+	for _, p := range resp.Players {
+		total += p.Probability
+	}
+	if len(resp.Players) != 2 || resp.Players[0].Player != a.ID || resp.Playouts != bot.EstimatePlayouts || math.Abs(total-1) > 1e-9 {
+		t.Errorf("got %+v", resp)
+	}
+
+	// the estimate of a position is kept
+	again := WinProbabilityResponse{}
+	s.send(MessageTypeWinProbability, nil)
+	s.expect(MessageTypeWinProbability, &again)
+	if len(again.Players) != 2 || again.Players[0].Probability != resp.Players[0].Probability || again.Stale {
+		t.Errorf("got %+v want %+v", again, resp)
+	}
+
+	// a position the game moved to is estimated again
+	roller := a
+	if first == b.ID {
+		roller = b
+	}
+	roller.send(MessageTypeBeginRoll, nil)
+	a.expect(MessageTypeEndRoll, nil)
+	s.send(MessageTypeWinProbability, nil)
+	s.expect(MessageTypeWinProbability, &again)
+	if len(again.Players) != 2 || again.Position <= resp.Position {
+		t.Errorf("got %+v after %+v", again, resp)
+	}
+}
@@ -1,58 +1,23 @@
 package main
 
 import (
+	"encoding/hex"
 	"log"
 	"math/rand"
+	"slices"
+	"time"
+
+	"github.com/AdventurerAmer/yutnori/bot"
+	"github.com/AdventurerAmer/yutnori/fair"
+	"github.com/AdventurerAmer/yutnori/rating"
+	"github.com/AdventurerAmer/yutnori/replay"
+	"github.com/AdventurerAmer/yutnori/rules"
 )
 
-const MaxPieceCountInRoom = 6
-const MinPieceCountInRoom = 2
-
-type CellID uint8
-
-const (
-	BottomRightCorner CellID = iota
-	Right0
-	Right1
-	Right2
-	Right3
-	TopRightCorner
-	Top0
-	Top1
-	Top2
-	Top3
-	TopLeftCorner
-	Left0
-	Left1
-	Left2
-	Left3
-	BottomLeftCorner
-	Bottom0
-	Bottom1
-	Bottom2
-	Bottom3
-	MainDiagonal0
-	MainDiagonal1
-	MainDiagonal2
-	MainDiagonal3
-	AntiDiagonal0
-	AntiDiagonal1
-	AntiDiagonal2
-	AntiDiagonal3
-	Center
-)
-
-type Piece struct {
-	IsAtStart  bool
-	IsFinished bool
-	Cell       CellID
-}
-
-type Move struct {
-	Roll  int
-	Cell  CellID
-	Piece int
-}
+const MaxPieceCountInRoom = rules.MaxPieceCount
+const MinPieceCountInRoom = rules.MinPieceCount
+const MaxTeamCountInRoom = 3
+const MinTeamCountInRoom = 2
 
 type GameState uint8
 
@@ -73,26 +38,120 @@ type PlayerState struct {
 	Client  *Client
 	Name    string
 	IsReady bool
-	Pieces  [MaxPieceCountInRoom]Piece
+	Team    int
+
+	Disconnected bool
+	GraceTimer   *time.Timer
+
+	Bank time.Duration // time left past the turn seconds
+
+	Bot  bot.Difficulty // empty for players
+	Left bool           // the player left and forfeited, the seat is freed once the game ends
+
+	Leaver string // identity of a player who left the seat during the game, rated last
 }
 
 type GameInstance struct {
 	Players             []PlayerState
 	PieceCount          uint8
+	TeamCount           uint8 // zero means every player plays for themselves
+	Rules               rules.RuleSet
+	ThrowModel          rules.ThrowModel
+	LastThrow           rules.Throw
+	Seed                int64
+	Rand                *rand.Rand
+	SeedSource          func() int64 // nil uses generateSeed
 	GameState           GameState
-	PlayerTurnIdx       int
-	Rolls               []int
+	State               *rules.State
 	EndMoveSet          map[*Client]struct{}
-	CurrentMove         Move
+	LegalMoves          []rules.Move
+	CurrentMove         rules.Move
 	CurrentMoveFinishes bool
+
+	Replay *replay.Replay
+
+	Fair              bool
+	ServerSeed        []byte
+	FairLog           fair.Log
+	ContributionsOpen bool
+	Contributors      map[*Client]struct{}
+
+	TimeControl  TimeControl
+	turnTimer    *time.Timer
+	timerAction  TimeoutAction
+	timerSeq     uint64 // bumped whenever the turn timer stops
+	TurnStarted  time.Time
+	TurnDeadline time.Time
+
+	BotRand *rand.Rand // bots and masters are picked with it, so they never change the rolls
+
+	estimate        WinEstimate
+	estimating      bool
+	estimateWaiters []*Client
 }
 
 func NewGameInstance() *GameInstance {
-	return &GameInstance{
+	g := &GameInstance{
 		PieceCount: MinPieceCountInRoom,
 		GameState:  GameStateGameEnded,
+		ThrowModel: rules.DefaultThrowModel,
 		EndMoveSet: make(map[*Client]struct{}),
+
+		Contributors: make(map[*Client]struct{}),
+
+		BotRand: rand.New(rand.NewSource(generateSeed())),
+	}
+	g.Reseed()
+	return g
+}
+
+// Reseed draws a new seed from SeedSource and restarts Rand from it, every
+// random decision of the game comes from Rand so a game can be reproduced
+// from its Seed.
+func (g *GameInstance) Reseed() {
+	if g.SeedSource != nil {
+		g.Seed = g.SeedSource()
+	} else {
+		g.Seed = generateSeed()
 	}
+	g.Rand = rand.New(rand.NewSource(g.Seed))
+}
+
+// commitSeed starts a fair game, the starting player is drawn from the
+// committed server seed alone.
+func (g *GameInstance) commitSeed() {
+	g.ServerSeed = fair.NewServerSeed()
+	g.Seed = fair.StartSeed(g.ServerSeed)
+	g.Rand = fair.NewRand(g.Seed)
+	g.FairLog = fair.Log{
+		Commitment:  fair.Commit(g.ServerSeed),
+		PlayerCount: len(g.Players),
+		ThrowModel:  g.ThrowModel,
+	}
+	g.ContributionsOpen = true
+	clear(g.Contributors)
+}
+
+// closeContributions mixes the players' entropy into the seed the throws are
+// drawn from, it happens right before the first throw.
+func (g *GameInstance) closeContributions() {
+	g.ContributionsOpen = false
+	g.Seed = fair.GameSeed(g.ServerSeed, g.FairLog.Contributions)
+	g.Rand = fair.NewRand(g.Seed)
+}
+
+func (g *GameInstance) RevealSeed(r *Room) {
+	if !g.Fair || g.ServerSeed == nil {
+		return
+	}
+	g.FairLog.ServerSeed = hex.EncodeToString(g.ServerSeed)
+	err := r.Broadcast(RevealSeedResponse{Log: g.FairLog})
+	if err != nil {
+		log.Println(err)
+	}
+	log.Printf("room '%s' revealed the seed %d\n", r.ID, g.Seed)
+	g.ServerSeed = nil
+	g.ContributionsOpen = false
 }
 
 func (g *GameInstance) GetClientIndex(c *Client) int {
@@ -109,6 +168,98 @@ func (g *GameInstance) IsClientInRoom(c *Client) bool {
 	return idx != -1
 }
 
+// ReplaceClient hands everything the game knows about a client over to the
+// client that reconnected in its place.
+func (g *GameInstance) ReplaceClient(old *Client, client *Client) {
+	if _, ok := g.EndMoveSet[old]; ok {
+		delete(g.EndMoveSet, old)
+		g.EndMoveSet[client] = struct{}{}
+	}
+	if _, ok := g.Contributors[old]; ok {
+		delete(g.Contributors, old)
+		g.Contributors[client] = struct{}{}
+	}
+}
+
+func (g *GameInstance) Snapshot() GameSnapshot {
+	snapshot := GameSnapshot{
+		GameState:   g.GameState,
+		PieceCount:  g.PieceCount,
+		TeamCount:   g.TeamCount,
+		Rules:       g.Rules,
+		Rolls:       []int{},
+		LegalMoves:  []LegalMoveResponse{},
+		MoveAcks:    []ClientID{},
+		WinningTeam: -1,
+		Ranking:     []int{},
+	}
+	for _, p := range g.Players {
+		if _, ok := g.EndMoveSet[p.Client]; ok {
+			snapshot.MoveAcks = append(snapshot.MoveAcks, p.Client.ID)
+		}
+	}
+	// players can join and leave once the game ended, State only matches the
+	// seats during a game
+	if g.State == nil || g.GameState == GameStateGameEnded {
+		for _, p := range g.Players {
+			snapshot.Players = append(snapshot.Players, PlayerSnapshot{
+				ClientID:     p.Client.ID,
+				Name:         p.Name,
+				IsReady:      p.IsReady,
+				Team:         p.Team,
+				Disconnected: p.Disconnected,
+				Bot:          p.Bot,
+				BotMode:      p.Client.BotMode(),
+			})
+		}
+		return snapshot
+	}
+	snapshot.PieceCount = uint8(g.State.PieceCount)
+	snapshot.Rules = g.State.Rules
+	snapshot.PlayerTurn = g.CurrentPlayer().Client.ID
+	snapshot.PlayerTurnIdx = g.State.Turn
+	snapshot.Rolls = append(snapshot.Rolls, g.State.Rolls...)
+	snapshot.BonusThrows = g.State.BonusThrows
+	snapshot.WinningTeam = g.State.WinningTeam
+	snapshot.Ranking = append(snapshot.Ranking, g.State.Ranking...)
+	snapshot.Timer = g.timerResponse()
+	if g.GameState == GameStateSelectingMove {
+		snapshot.LegalMoves = g.legalMoveResponses()
+	}
+	if g.GameState == GameStateBeginMove {
+		path, err := g.State.CheckMove(g.CurrentMove)
+		if err == nil {
+			snapshot.CurrentMove = &LegalMoveResponse{
+				Roll:     g.CurrentMove.Roll,
+				Cell:     g.CurrentMove.Cell,
+				Piece:    g.CurrentMove.Piece,
+				Outer:    g.CurrentMove.Outer,
+				Path:     pathResponse(path),
+				Finished: path.Finished,
+			}
+		}
+	}
+	for idx, p := range g.Players {
+		team := g.State.Players[idx].Team
+		snapshot.Players = append(snapshot.Players, PlayerSnapshot{
+			ClientID:     p.Client.ID,
+			Name:         p.Name,
+			IsReady:      p.IsReady,
+			Team:         team,
+			Disconnected: p.Disconnected,
+			Bot:          p.Bot,
+			BotMode:      p.Client.BotMode(),
+			Left:         p.Left,
+			Pieces:       slices.Clone(g.State.Teams[team].Pieces[:g.State.PieceCount]),
+		})
+	}
+	return snapshot
+}
+
+func (g *GameInstance) CurrentPlayer() *PlayerState {
+	return &g.Players[g.State.Turn]
+}
+
 func (g *GameInstance) Start(room *Room) {
 	if g.GameState != GameStateGameEnded {
 		log.Printf("illegal move action should be %d got %d\n", GameStateGameEnded, g.GameState)
@@ -127,11 +278,47 @@ func (g *GameInstance) Start(room *Room) {
 		return
 	}
 
+	if g.TeamCount != 0 && !g.AreTeamsBalanced() {
+		room.Broadcast(StartGameResponse{})
+		return
+	}
+
 	g.Reset()
-	g.PlayerTurnIdx = rand.Intn(len(g.Players))
-	err := room.Broadcast(StartGameResponse{
+	if g.Fair {
+		g.commitSeed()
+	} else {
+		g.Reseed()
+	}
+	teams := make([]int, len(g.Players))
+	for idx, p := range g.Players {
+		teams[idx] = idx
+		if g.TeamCount != 0 {
+			teams[idx] = p.Team
+		}
+	}
+	state, err := rules.NewTeamState(teams, int(g.PieceCount))
+	if err != nil {
+		log.Println(err)
+		room.Broadcast(StartGameResponse{})
+		return
+	}
+	g.State = state
+	g.State.Rules = g.Rules
+	startingPlayer := g.Rand.Intn(len(g.Players))
+	events, err := g.State.Start(startingPlayer)
+	if err != nil {
+		log.Println(err)
+		room.Broadcast(StartGameResponse{})
+		return
+	}
+	g.FairLog.StartingPlayer = startingPlayer
+	g.Replay = g.newReplay(room, teams, startingPlayer)
+	// the seed would predict every throw, it is only logged once revealed
+	log.Printf("room '%s' started a game\n", room.ID)
+	err = room.Broadcast(StartGameResponse{
 		ShouldStart:    true,
-		StartingPlayer: g.Players[g.PlayerTurnIdx].Client.ID,
+		StartingPlayer: g.CurrentPlayer().Client.ID,
+		SeedCommitment: g.FairLog.Commitment,
 	})
 	if err != nil {
 		log.Println(err)
@@ -140,60 +327,319 @@ func (g *GameInstance) Start(room *Room) {
 	if err != nil {
 		log.Println(err)
 	}
-	room.Broadcast(CallRollResponse{Player: g.Players[g.PlayerTurnIdx].Client.ID})
-	g.GameState = GameStateCanRoll
+	g.BroadcastEvents(room, events)
+}
+
+// AreTeamsBalanced reports whether every team has the same, non-zero number
+// of players.
+func (g *GameInstance) AreTeamsBalanced() bool {
+	sizes := make([]int, g.TeamCount)
+	for _, p := range g.Players {
+		if p.Team < 0 || p.Team >= len(sizes) {
+			return false
+		}
+		sizes[p.Team]++
+	}
+	for _, size := range sizes {
+		if size == 0 || size != sizes[0] {
+			return false
+		}
+	}
+	return true
+}
+
+func (g *GameInstance) SmallestTeam() int {
+	if g.TeamCount == 0 {
+		return 0
+	}
+	sizes := make([]int, g.TeamCount)
+	for _, p := range g.Players {
+		if p.Team >= 0 && p.Team < len(sizes) {
+			sizes[p.Team]++
+		}
+	}
+	smallest := 0
+	for team, size := range sizes {
+		if size < sizes[smallest] {
+			smallest = team
+		}
+	}
+	return smallest
+}
+
+func (g *GameInstance) newReplay(r *Room, teams []int, startingPlayer int) *replay.Replay {
+	settings := replay.Settings{
+		PieceCount: int(g.PieceCount),
+		TeamCount:  int(g.TeamCount),
+		Rules:      g.Rules,
+		ThrowModel: g.ThrowModel,
+		Fair:       g.Fair,
+	}
+	players := make([]replay.Player, len(g.Players))
+	for idx, p := range g.Players {
+		players[idx] = replay.Player{ID: string(p.Client.ID), Name: p.Name, Team: teams[idx]}
+	}
+	rp := replay.New(settings, players, startingPlayer)
+	rp.RoomID = string(r.ID)
+	return rp
+}
+
+// SaveReplay writes the replay of the current game to the room's replay
+// directory, it is called once the game is over.
+func (g *GameInstance) SaveReplay(r *Room) {
+	if g.Replay == nil {
+		return
+	}
+	g.Replay.Seed = g.Seed
+	g.Replay.Finish(g.State)
+	if r.ReplayDir != "" {
+		path, err := g.Replay.Save(r.ReplayDir)
+		if err != nil {
+			log.Println(err)
+		} else {
+			log.Printf("saved replay '%s'\n", path)
+		}
+	}
+	g.Replay = nil
+}
+
+func (g *GameInstance) teamClients(team int) []ClientID {
+	clients := []ClientID{}
+	for _, playerIdx := range g.State.TeamMembers(team) {
+		clients = append(clients, g.Players[playerIdx].Client.ID)
+	}
+	return clients
+}
+
+// teamPlaces ranks the teams of a finished game, the teams that finished come
+// first in their finishing order and the others are ranked by their finished
+// pieces then by their pieces on the board. Teams with the same progress
+// share a place.
+func (g *GameInstance) teamPlaces() []int {
+	type progress struct{ ranked, finished, onBoard int }
+	teams := make([]progress, len(g.State.Teams))
+	for idx, team := range g.State.Teams {
+		if place := slices.Index(g.State.Ranking, idx); place != -1 {
+			teams[idx].ranked = len(g.State.Ranking) - place
+		}
+		for _, piece := range team.Pieces[:g.State.PieceCount] {
+			if piece.IsFinished {
+				teams[idx].finished++
+			} else if !piece.IsAtStart {
+				teams[idx].onBoard++
+			}
+		}
+	}
+	better := func(a, b progress) bool {
+		if a.ranked != b.ranked {
+			return a.ranked > b.ranked
+		}
+		if a.finished != b.finished {
+			return a.finished > b.finished
+		}
+		return a.onBoard > b.onBoard
+	}
+	places := make([]int, len(teams))
+	for idx := range teams {
+		for other := range teams {
+			if better(teams[other], teams[idx]) {
+				places[idx]++
+			}
+		}
+	}
+	return places
+}
+
+// RecordRatings rates the finished game for the players that identified
+// themselves, it needs identified players on at least two teams.
+func (g *GameInstance) RecordRatings(r *Room) {
+	if r.Ratings == nil || g.State == nil {
+		return
+	}
+	places := g.teamPlaces()
+	results := []rating.Result{}
+	clients := map[string]ClientID{}
+	before := map[string]float64{}
+	teams := map[int]struct{}{}
+	for idx, p := range g.Players {
+		team := g.State.Players[idx].Team
+		identity, place := p.Client.Identity(), places[team]
+		// leaving does not spare a loss, the leaver takes the last place
+		if p.Leaver != "" {
+			identity, place = p.Leaver, len(g.State.Teams)-1
+		}
+		if identity == "" {
+			continue
+		}
+		results = append(results, rating.Result{Player: identity, Team: team, Place: place})
+		if p.Leaver == "" {
+			clients[identity] = p.Client.ID
+		}
+		before[identity] = r.Ratings.Rating(identity)
+		teams[team] = struct{}{}
+	}
+	if len(teams) < 2 {
+		return
+	}
+	players, err := r.Ratings.Record(results)
+	if err != nil {
+		log.Println(err)
+	}
+	response := RatingResponse{Players: []PlayerRating{}}
+	for _, p := range players {
+		rated := playerRating(p)
+		rated.ClientID = clients[p.ID]
+		rated.Delta = p.Rating - before[p.ID]
+		response.Players = append(response.Players, rated)
+	}
+	err = r.Broadcast(response)
+	if err != nil {
+		log.Println(err)
+	}
 }
 
 func (g *GameInstance) Reset() {
+	g.stopTurnTimer()
 	g.GameState = GameStateGameEnded
+	g.State = nil
+	g.LegalMoves = nil
+	g.Replay = nil
+	g.ServerSeed = nil
+	g.FairLog = fair.Log{}
+	g.ContributionsOpen = false
 	for playerIdx := range g.Players {
-		g.Players[playerIdx].IsReady = false
-		for pieceIdx := 0; pieceIdx < MaxPieceCountInRoom; pieceIdx++ {
-			g.Players[playerIdx].Pieces[pieceIdx] = Piece{
-				Cell:       BottomRightCorner,
-				IsAtStart:  true,
-				IsFinished: false,
+		g.Players[playerIdx].IsReady = g.Players[playerIdx].Bot != ""
+		g.Players[playerIdx].Bank = time.Duration(g.TimeControl.BankSeconds) * time.Second
+		g.Players[playerIdx].Leaver = ""
+	}
+}
+
+// BroadcastEvents translates the events reported by the rules engine into
+// messages, records them in the replay and keeps GameState in step with the
+// engine.
+func (g *GameInstance) BroadcastEvents(r *Room, events []rules.Event) {
+	if g.Replay != nil {
+		g.Replay.Record(events...)
+	}
+	for _, event := range events {
+		var err error
+		switch e := event.(type) {
+		case rules.RollEvent:
+			err = r.Broadcast(EndRollResponse{
+				ShouldAppend: e.Appended,
+				Roll:         e.Roll,
+				Sticks:       g.LastThrow.Sticks,
+			})
+		case rules.CallRollEvent:
+			g.GameState = GameStateCanRoll
+			err = r.Broadcast(CallRollResponse{
+				Player: g.Players[e.Player].Client.ID,
+				Timer:  g.startTurnTimer(r),
+			})
+			g.playBot(r)
+		case rules.SelectingMoveEvent:
+			g.GameState = GameStateSelectingMove
+			err = r.Broadcast(SelectingMoveResponse{
+				Player: g.Players[e.Player].Client.ID,
+				Moves:  g.updateLegalMoves(),
+				Timer:  g.startTurnTimer(r),
+			})
+			g.playBot(r)
+		case rules.EndTurnEvent:
+			err = r.Broadcast(EndTurnResponse{NextPlayer: g.Players[e.NextPlayer].Client.ID})
+			if err == nil {
+				err = r.Broadcast(BeginTurnResponse{})
+			}
+		case rules.TeamFinishedEvent:
+			err = r.Broadcast(TeamFinishedResponse{
+				Team:    e.Team,
+				Place:   e.Place,
+				Players: g.teamClients(e.Team),
+			})
+		case rules.ForfeitEvent:
+			err = r.Broadcast(PlayerForfeitedResponse{
+				Player:  g.Players[e.Player].Client.ID,
+				Team:    e.Team,
+				TeamOut: e.TeamOut,
+			})
+		case rules.EndGameEvent:
+			g.GameState = GameStateGameEnded
+			g.stopTurnTimer()
+			winners := g.teamClients(e.Team)
+			// with the full finishing order the last move is made by the last
+			// team to finish, not by the winners
+			winner := g.Players[e.Player].Client.ID
+			if g.State.Players[e.Player].Team != e.Team {
+				winner = winners[0]
+			}
+			ranking := [][]ClientID{}
+			for _, team := range g.State.Ranking {
+				ranking = append(ranking, g.teamClients(team))
 			}
+			err = r.Broadcast(EndGameResponse{
+				Winner:      winner,
+				WinningTeam: e.Team,
+				Winners:     winners,
+				Ranking:     ranking,
+			})
+			g.RevealSeed(r)
+			g.SaveReplay(r)
+			g.RecordRatings(r)
+			g.dropLeftSeats()
+		}
+		if err != nil {
+			log.Println(err)
 		}
 	}
 }
 
-func (g *GameInstance) Roll() (int, bool) {
-	dist := []int{10, 10, 20, 20, 20, 10, 10}
-	space := []int{-1, 0, 1, 2, 3, 4, 5}
+// updateLegalMoves stores the moves the current player can choose from, so
+// that BeginMoveGameAction validates against exactly what the clients got.
+func (g *GameInstance) updateLegalMoves() []LegalMoveResponse {
+	g.LegalMoves = g.State.LegalMoves()
+	return g.legalMoveResponses()
+}
 
-	r := int(rand.Int31n(100))
-	acc := 0
-	idx := -1
-	for i := 0; i < len(dist); i++ {
-		acc += dist[i]
-		if r < acc {
-			idx = i
-			break
+func (g *GameInstance) legalMoveResponses() []LegalMoveResponse {
+	moves := make([]LegalMoveResponse, 0, len(g.LegalMoves))
+	for _, m := range g.LegalMoves {
+		path, err := g.State.CheckMove(m)
+		if err != nil {
+			log.Println(err)
+			continue
 		}
-	}
-	n := space[idx]
+		moves = append(moves, LegalMoveResponse{
+			Roll:     m.Roll,
+			Cell:     m.Cell,
+			Piece:    m.Piece,
+			Outer:    m.Outer,
+			Path:     pathResponse(path),
+			Finished: path.Finished,
+		})
+	}
+	return moves
+}
 
-	shouldAppend := true
-	if n == 0 {
-		shouldAppend = false
-		g.Rolls = g.Rolls[:0]
+// TryEndMove applies the current move once every connected player
+// acknowledged it.
+func (g *GameInstance) TryEndMove(r *Room) {
+	if g.GameState != GameStateBeginMove {
+		return
 	}
-	player := g.Players[g.PlayerTurnIdx]
-	IsAllPiecesAtStart := true
-	for _, piece := range player.Pieces {
-		if !piece.IsAtStart {
-			IsAllPiecesAtStart = false
-			break
+	for _, p := range g.Players {
+		if _, ok := g.EndMoveSet[p.Client]; !ok && !p.Disconnected {
+			return
 		}
 	}
-	if n == -1 && IsAllPiecesAtStart && len(g.Rolls) == 0 {
-		shouldAppend = false
-	}
-	if shouldAppend {
-		g.Rolls = append(g.Rolls, n)
+
+	log.Println("EndMove...")
+
+	events, err := g.State.ApplyMove(g.CurrentMove)
+	if err != nil {
+		log.Println(err)
+		return
 	}
-	return n, shouldAppend
+	g.BroadcastEvents(r, events)
 }
 
 type SetPieceCountGameAction struct {
@@ -213,52 +659,170 @@ func (s SetPieceCountGameAction) Execute(c *Client, r *Room) {
 	}
 }
 
-type BeginRollGameAction struct {
+type SetRuleSetGameAction struct {
+	Rules rules.RuleSet
 }
 
-func (b BeginRollGameAction) Execute(c *Client, r *Room) {
+func (s SetRuleSetGameAction) Execute(c *Client, r *Room) {
 	instance := r.GameInstance
-	if instance.GameState != GameStateCanRoll {
-		log.Printf("illegal move action should be %d got %d\n", GameStateCanRoll, instance.GameState)
+	if instance.GameState != GameStateGameEnded || c != r.Master {
+		c.Send(SetRuleSetResponse{ShouldSet: false, Rules: instance.Rules})
 		return
 	}
-	player := &instance.Players[instance.PlayerTurnIdx]
-	if player.Client != c {
-		log.Printf("permission denied action should be from client '%s' but got '%s'\n", player.Client.ID, c.ID)
+	instance.Rules = s.Rules
+	err := r.Broadcast(SetRuleSetResponse{ShouldSet: true, Rules: s.Rules})
+	if err != nil {
+		log.Println(err)
+	}
+}
+
+type SetThrowModelGameAction struct {
+	ThrowModel rules.ThrowModel
+}
+
+func (s SetThrowModelGameAction) Execute(c *Client, r *Room) {
+	instance := r.GameInstance
+	if instance.GameState != GameStateGameEnded || c != r.Master {
+		c.Send(SetThrowModelResponse{ShouldSet: false, ThrowModel: instance.ThrowModel})
 		return
 	}
-	n, shouldAppend := instance.Roll()
-	err := r.Broadcast(EndRollResponse{ShouldAppend: shouldAppend, Roll: n})
+	instance.ThrowModel = s.ThrowModel
+	err := r.Broadcast(SetThrowModelResponse{ShouldSet: true, ThrowModel: s.ThrowModel})
 	if err != nil {
 		log.Println(err)
 	}
-	if n == 4 || n == 5 {
-		r.Broadcast(CallRollResponse{Player: player.Client.ID})
-		instance.GameState = GameStateCanRoll
-	} else if len(instance.Rolls) == 0 {
-		instance.PlayerTurnIdx += 1
-		instance.PlayerTurnIdx %= len(instance.Players)
-		err := r.Broadcast(EndTurnResponse{NextPlayer: instance.Players[instance.PlayerTurnIdx].Client.ID})
-		if err != nil {
-			log.Println(err)
+}
+
+type SetFairModeGameAction struct {
+	Fair bool
+}
+
+func (s SetFairModeGameAction) Execute(c *Client, r *Room) {
+	instance := r.GameInstance
+	if instance.GameState != GameStateGameEnded || c != r.Master {
+		c.Send(SetFairModeResponse{ShouldSet: false, Fair: instance.Fair})
+		return
+	}
+	instance.Fair = s.Fair
+	err := r.Broadcast(SetFairModeResponse{ShouldSet: true, Fair: s.Fair})
+	if err != nil {
+		log.Println(err)
+	}
+}
+
+type ContributeEntropyGameAction struct {
+	Entropy string
+}
+
+func (ce ContributeEntropyGameAction) Execute(c *Client, r *Room) {
+	instance := r.GameInstance
+	_, contributed := instance.Contributors[c]
+	if !instance.Fair || !instance.ContributionsOpen || contributed ||
+		len(ce.Entropy) == 0 || len(ce.Entropy) > fair.MaxContributionLength {
+		c.Send(ContributeEntropyResponse{})
+		return
+	}
+	instance.Contributors[c] = struct{}{}
+	instance.FairLog.Contributions = append(instance.FairLog.Contributions, ce.Entropy)
+	err := r.Broadcast(ContributeEntropyResponse{Accepted: true, Player: c.ID, Entropy: ce.Entropy})
+	if err != nil {
+		log.Println(err)
+	}
+}
+
+type SetTeamCountGameAction struct {
+	TeamCount uint8
+}
+
+func (s SetTeamCountGameAction) Execute(c *Client, r *Room) {
+	instance := r.GameInstance
+	if instance.GameState != GameStateGameEnded || c != r.Master {
+		c.Send(SetTeamCountResponse{ShouldSet: false})
+		return
+	}
+	instance.TeamCount = s.TeamCount
+	teams := []PlayerTeamResponse{}
+	for idx := range instance.Players {
+		player := &instance.Players[idx]
+		player.Team = 0
+		if s.TeamCount != 0 {
+			player.Team = idx % int(s.TeamCount)
 		}
-		err = r.Broadcast(BeginTurnResponse{})
-		if err != nil {
-			log.Println(err)
+		teams = append(teams, PlayerTeamResponse{Player: player.Client.ID, Team: player.Team})
+	}
+	err := r.Broadcast(SetTeamCountResponse{ShouldSet: true, TeamCount: s.TeamCount, Teams: teams})
+	if err != nil {
+		log.Println(err)
+	}
+}
+
+type SetTeamGameAction struct {
+	Player ClientID
+	Team   int
+}
+
+func (s SetTeamGameAction) Execute(c *Client, r *Room) {
+	instance := r.GameInstance
+	if instance.GameState != GameStateGameEnded || c != r.Master ||
+		s.Team < 0 || s.Team >= int(instance.TeamCount) {
+		c.Send(SetTeamResponse{ShouldSet: false})
+		return
+	}
+	for idx := range instance.Players {
+		player := &instance.Players[idx]
+		if player.Client.ID != s.Player {
+			continue
 		}
-		r.Broadcast(CallRollResponse{Player: instance.Players[instance.PlayerTurnIdx].Client.ID})
-		instance.GameState = GameStateCanRoll
-	} else {
-		r.Broadcast(SelectingMoveResponse{Player: player.Client.ID})
+		player.Team = s.Team
+		err := r.Broadcast(SetTeamResponse{ShouldSet: true, Player: s.Player, Team: s.Team})
 		if err != nil {
 			log.Println(err)
 		}
-		instance.GameState = GameStateSelectingMove
+		return
+	}
+	c.Send(SetTeamResponse{ShouldSet: false})
+}
+
+// roll throws for the current player.
+func (g *GameInstance) roll(r *Room) {
+	if g.Fair && g.ContributionsOpen {
+		g.closeContributions()
+	}
+	g.LastThrow = g.ThrowModel.Throw(g.Rand)
+	if g.Fair {
+		g.FairLog.Rolls = append(g.FairLog.Rolls, fair.Roll{
+			Roll:   g.LastThrow.Roll,
+			Sticks: g.LastThrow.Sticks,
+		})
+	}
+	events, err := g.State.ApplyRoll(g.LastThrow.Roll)
+	if err != nil {
+		log.Println(err)
+		return
 	}
+	g.BroadcastEvents(r, events)
+}
+
+type BeginRollGameAction struct {
+}
+
+func (b BeginRollGameAction) Execute(c *Client, r *Room) {
+	instance := r.GameInstance
+	if instance.GameState != GameStateCanRoll {
+		log.Printf("illegal move action should be %d got %d\n", GameStateCanRoll, instance.GameState)
+		return
+	}
+	player := instance.CurrentPlayer()
+	if player.Client != c {
+		log.Printf("permission denied action should be from client '%s' but got '%s'\n", player.Client.ID, c.ID)
+		return
+	}
+	instance.chargeTurnTimer()
+	instance.roll(r)
 }
 
 type BeginMoveGameAction struct {
-	Move
+	rules.Move
 }
 
 func (b BeginMoveGameAction) Execute(c *Client, r *Room) {
@@ -268,69 +832,48 @@ func (b BeginMoveGameAction) Execute(c *Client, r *Room) {
 		c.Send(BeginMoveRespone{})
 		return
 	}
-	currentPlayer := &instance.Players[instance.PlayerTurnIdx]
-	if currentPlayer.Client != c || b.Piece >= int(instance.PieceCount) { // illegal
+	currentPlayer := instance.CurrentPlayer()
+	if currentPlayer.Client != c || !slices.Contains(instance.LegalMoves, b.Move) { // illegal
 		log.Println("illegal")
 		c.Send(BeginMoveRespone{})
 		return
 	}
-	pieceToMove := currentPlayer.Pieces[b.Piece]
-	log.Printf("Piece: %+v\n", pieceToMove)
-	if pieceToMove.IsFinished { // illiegal
-		log.Println("illegal")
-		c.Send(BeginMoveRespone{})
-		return
-	}
-
-	rollIdx := -1
-	for idx, roll := range instance.Rolls {
-		if roll == b.Roll {
-			rollIdx = idx
-			break
-		}
-	}
-
-	if rollIdx == -1 { // illegal
-		log.Println("illegal")
+	path, err := instance.State.CheckMove(b.Move)
+	if err != nil { // illegal
+		log.Println(err)
 		c.Send(BeginMoveRespone{})
 		return
 	}
+	instance.chargeTurnTimer()
+	instance.beginMove(r, b.Move, path)
+}
 
-	seq0, seq1, finished := getMoveSeq(pieceToMove, b.Roll)
-	isValidMove := false
-	if len(seq0) != 0 && seq0[len(seq0)-1] == b.Cell {
-		isValidMove = true
-	}
-	if len(seq1) != 0 && seq0[len(seq1)-1] == b.Cell {
-		isValidMove = true
-	}
-	if !isValidMove { // illegal
-		log.Println("illegal")
-		r.Broadcast(BeginMoveRespone{})
-		return
-	}
-	instance.Rolls = append(instance.Rolls[:rollIdx], instance.Rolls[rollIdx+1:]...)
-
-	clear(instance.EndMoveSet)
+// beginMove starts animating a checked move of the current player.
+func (g *GameInstance) beginMove(r *Room, m rules.Move, path rules.Path) {
+	clear(g.EndMoveSet)
 
-	instance.CurrentMove = b.Move
-	instance.CurrentMoveFinishes = finished
+	g.CurrentMove = m
+	g.CurrentMoveFinishes = path.Finished
 	err := r.Broadcast(BeginMoveRespone{
-		Player:     currentPlayer.Client.ID,
+		Player:     g.CurrentPlayer().Client.ID,
 		ShouldMove: true,
-		Roll:       b.Roll,
-		Cell:       b.Cell,
-		Piece:      b.Piece,
-		Finished:   finished,
+		Roll:       m.Roll,
+		Cell:       m.Cell,
+		Piece:      m.Piece,
+		Outer:      m.Outer,
+		Path:       pathResponse(path),
+		Finished:   path.Finished,
 	})
 	if err != nil {
 		log.Println(err)
 	}
-	instance.GameState = GameStateBeginMove
+	g.GameState = GameStateBeginMove
+	g.ackBotMoves()
+	g.TryEndMove(r)
 }
 
 type EndMoveGameAction struct {
-	Move
+	rules.Move
 }
 
 func (e EndMoveGameAction) Execute(c *Client, r *Room) {
@@ -339,102 +882,13 @@ func (e EndMoveGameAction) Execute(c *Client, r *Room) {
 		log.Println("illegal")
 		return
 	}
-	IsInRoom := false
-	for _, p := range instance.Players {
-		if c == p.Client {
-			IsInRoom = true
-			break
-		}
-	}
-
-	if !IsInRoom || e.Move != instance.CurrentMove {
+	if !instance.IsClientInRoom(c) || e.Move != instance.CurrentMove {
 		log.Println("illegal")
 		return
 	}
 
 	instance.EndMoveSet[c] = struct{}{}
-	if len(instance.EndMoveSet) != len(instance.Players) {
-		return
-	}
-
-	log.Println("EndMove...")
-
-	currentPlayer := &instance.Players[instance.PlayerTurnIdx]
-	pieceToMove := currentPlayer.Pieces[instance.CurrentMove.Piece]
-
-	// moving pieces
-	if pieceToMove.IsAtStart {
-		pieceToMove.IsFinished = false
-		pieceToMove.Cell = e.Cell
-		pieceToMove.IsAtStart = false
-		currentPlayer.Pieces[e.Piece] = pieceToMove
-	} else {
-		for pieceIdx := 0; pieceIdx < int(instance.PieceCount); pieceIdx++ {
-			piece := currentPlayer.Pieces[pieceIdx]
-			if piece.IsFinished {
-				continue
-			}
-			if piece.Cell == pieceToMove.Cell && !piece.IsAtStart {
-				piece.Cell = e.Cell
-				piece.IsFinished = instance.CurrentMoveFinishes
-			}
-			currentPlayer.Pieces[pieceIdx] = piece
-		}
-	}
-
-	// stomping an opponent piece
-	stomped := false
-	for playerIdx := 0; playerIdx < len(instance.Players); playerIdx++ {
-		player := &instance.Players[playerIdx]
-		for pieceIdx := 0; pieceIdx < int(instance.PieceCount); pieceIdx++ {
-			piece := player.Pieces[pieceIdx]
-			if piece.IsFinished {
-				continue
-			}
-			if piece.Cell == e.Cell &&
-				!piece.IsAtStart &&
-				playerIdx != instance.PlayerTurnIdx {
-				piece.Cell = BottomRightCorner
-				piece.IsAtStart = true
-				stomped = true
-			}
-			player.Pieces[pieceIdx] = piece
-		}
-	}
-	finishCount := 0
-	for _, p := range currentPlayer.Pieces {
-		if p.IsFinished {
-			finishCount++
-		}
-	}
-	if finishCount == int(r.GameInstance.PieceCount) {
-		r.GameInstance.GameState = GameStateGameEnded
-		err := r.Broadcast(EndGameResponse{Winner: currentPlayer.Client.ID})
-		if err != nil {
-			log.Println(err)
-		}
-	} else {
-		if stomped {
-			r.Broadcast(CallRollResponse{Player: currentPlayer.Client.ID})
-			r.GameInstance.GameState = GameStateCanRoll
-		} else if len(r.GameInstance.Rolls) == 0 {
-			r.GameInstance.PlayerTurnIdx += 1
-			r.GameInstance.PlayerTurnIdx %= len(r.GameInstance.Players)
-			err := r.Broadcast(EndTurnResponse{NextPlayer: r.GameInstance.Players[r.GameInstance.PlayerTurnIdx].Client.ID})
-			if err != nil {
-				log.Println(err)
-			}
-			err = r.Broadcast(BeginTurnResponse{})
-			if err != nil {
-				log.Println(err)
-			}
-			r.Broadcast(CallRollResponse{Player: r.GameInstance.Players[r.GameInstance.PlayerTurnIdx].Client.ID})
-			r.GameInstance.GameState = GameStateCanRoll
-		} else {
-			r.Broadcast(SelectingMoveResponse{Player: currentPlayer.Client.ID})
-			r.GameInstance.GameState = GameStateSelectingMove
-		}
-	}
+	instance.TryEndMove(r)
 }
 
 type ChangeNameGameAction struct {
@@ -454,234 +908,75 @@ func (cn ChangeNameGameAction) Execute(c *Client, r *Room) {
 	}
 }
 
-func getNextCell(id CellID, AtStartPosition bool) (CellID, bool) {
-	switch id {
-	case BottomRightCorner:
-		if AtStartPosition {
-			return Right0, false
-		}
-		return BottomRightCorner, true
-	case Right0:
-		return Right1, false
-	case Right1:
-		return Right2, false
-	case Right2:
-		return Right3, false
-	case Right3:
-		return TopRightCorner, false
-	case TopRightCorner:
-		return AntiDiagonal0, false
-	case Top0:
-		return Top1, false
-	case Top1:
-		return Top2, false
-	case Top2:
-		return Top3, false
-	case Top3:
-		return TopLeftCorner, false
-	case TopLeftCorner:
-		return MainDiagonal0, false
-	case Left0:
-		return Left1, false
-	case Left1:
-		return Left2, false
-	case Left2:
-		return Left3, false
-	case Left3:
-		return BottomLeftCorner, false
-	case BottomLeftCorner:
-		return Bottom0, false
-	case Bottom0:
-		return Bottom1, false
-	case Bottom1:
-		return Bottom2, false
-	case Bottom2:
-		return Bottom3, false
-	case Bottom3:
-		return BottomRightCorner, false
-	case MainDiagonal0:
-		return MainDiagonal1, false
-	case MainDiagonal1:
-		return Center, false
-	case MainDiagonal2:
-		return MainDiagonal3, false
-	case MainDiagonal3:
-		return BottomRightCorner, false
-	case AntiDiagonal0:
-		return AntiDiagonal1, false
-	case AntiDiagonal1:
-		return Center, false
-	case AntiDiagonal2:
-		return AntiDiagonal3, false
-	case AntiDiagonal3:
-		return BottomLeftCorner, false
-	case Center:
-		return MainDiagonal2, false
-	}
-	return BottomRightCorner, false
-}
-
-func getNextPassingCell(prev CellID, id CellID) (CellID, bool) {
-	switch id {
-	case BottomRightCorner:
-		return BottomRightCorner, true
-	case Right0:
-		return Right1, false
-	case Right1:
-		return Right2, false
-	case Right2:
-		return Right3, false
-	case Right3:
-		return TopRightCorner, false
-	case TopRightCorner:
-		return Top0, false
-	case Top0:
-		return Top1, false
-	case Top1:
-		return Top2, false
-	case Top2:
-		return Top3, false
-	case Top3:
-		return TopLeftCorner, false
-	case TopLeftCorner:
-		return Left0, false
-	case Left0:
-		return Left1, false
-	case Left1:
-		return Left2, false
-	case Left2:
-		return Left3, false
-	case Left3:
-		return BottomLeftCorner, false
-	case BottomLeftCorner:
-		return Bottom0, false
-	case Bottom0:
-		return Bottom1, false
-	case Bottom1:
-		return Bottom2, false
-	case Bottom2:
-		return Bottom3, false
-	case Bottom3:
-		return BottomRightCorner, false
-	case MainDiagonal0:
-		return MainDiagonal1, false
-	case MainDiagonal1:
-		return Center, false
-	case MainDiagonal2:
-		return MainDiagonal3, false
-	case MainDiagonal3:
-		return BottomRightCorner, false
-	case AntiDiagonal0:
-		return AntiDiagonal1, false
-	case AntiDiagonal1:
-		return Center, false
-	case AntiDiagonal2:
-		return AntiDiagonal3, false
-	case AntiDiagonal3:
-		return BottomLeftCorner, false
-	case Center:
-		if prev == MainDiagonal1 {
-			return MainDiagonal2, false
-		} else if prev == AntiDiagonal1 {
-			return AntiDiagonal2, false
-		}
+type GameSnapshotGameAction struct{}
+
+func (gs GameSnapshotGameAction) Execute(c *Client, r *Room) {
+	c.Send(r.GameInstance.Snapshot())
+}
+
+func (gs GameSnapshotGameAction) SpectatorAllowed() bool {
+	return true
+}
+
+// SetPasswordGameAction sets the password asked to the clients entering the
+// room, an empty password opens the room to anyone knowing its ID or invite
+// code. The members are only told whether the room has a password.
+type SetPasswordGameAction struct {
+	Password string
+}
+
+func (sp SetPasswordGameAction) Execute(c *Client, r *Room) {
+	if c != r.Master {
+		c.Send(SetPasswordResponse{ShouldSet: false, Password: r.Password != ""})
+		return
 	}
-	return BottomRightCorner, false
-}
-
-func getPrevCell(id CellID) (CellID, CellID) {
-	switch id {
-	case BottomRightCorner:
-		return Bottom3, MainDiagonal3
-	case Right0:
-		return BottomRightCorner, BottomRightCorner
-	case Right1:
-		return Right0, Right0
-	case Right2:
-		return Right1, Right1
-	case Right3:
-		return Right2, Right2
-	case TopRightCorner:
-		return Right3, Right3
-	case Top0:
-		return TopRightCorner, TopRightCorner
-	case Top1:
-		return Top0, Top0
-	case Top2:
-		return Top1, Top1
-	case Top3:
-		return Top2, Top2
-	case TopLeftCorner:
-		return Top3, Top3
-	case Left0:
-		return TopLeftCorner, TopLeftCorner
-	case Left1:
-		return Left0, Left0
-	case Left2:
-		return Left1, Left1
-	case Left3:
-		return Left2, Left2
-	case BottomLeftCorner:
-		return Left3, AntiDiagonal3
-	case Bottom0:
-		return BottomLeftCorner, BottomLeftCorner
-	case Bottom1:
-		return Bottom0, Bottom0
-	case Bottom2:
-		return Bottom1, Bottom1
-	case Bottom3:
-		return Bottom2, Bottom2
-	case MainDiagonal0:
-		return TopLeftCorner, TopLeftCorner
-	case MainDiagonal1:
-		return MainDiagonal0, MainDiagonal0
-	case MainDiagonal2:
-		return Center, Center
-	case MainDiagonal3:
-		return MainDiagonal2, MainDiagonal2
-	case AntiDiagonal0:
-		return TopRightCorner, TopRightCorner
-	case AntiDiagonal1:
-		return AntiDiagonal0, AntiDiagonal0
-	case AntiDiagonal2:
-		return Center, Center
-	case AntiDiagonal3:
-		return AntiDiagonal2, AntiDiagonal2
-	case Center:
-		return MainDiagonal1, AntiDiagonal1
-	}
-	return BottomRightCorner, BottomRightCorner
-}
-
-func getMoveSeq(piece Piece, roll int) ([]CellID, []CellID, bool) {
-	var (
-		seq0 []CellID
-		seq1 []CellID
-	)
-	if roll == -1 {
-		if !piece.IsAtStart {
-			back0, back1 := getPrevCell(piece.Cell)
-			seq0 = append(seq0, back0)
-			if back1 != back0 {
-				seq1 = append(seq1, back1)
-			}
-		}
-		return seq0, seq1, false
+	r.Password = sp.Password
+	err := r.Broadcast(SetPasswordResponse{ShouldSet: true, Password: sp.Password != ""})
+	if err != nil {
+		log.Println(err)
 	}
+}
+
+// SetVisibilityGameAction lists the room in the public room listing or takes
+// it out, unlike the game settings it can be changed during a game.
+type SetVisibilityGameAction struct {
+	Public bool
+}
 
-	prev_cell := piece.Cell
-	next_cell, finish := getNextCell(piece.Cell, piece.IsAtStart)
-	seq0 = append(seq0, next_cell)
-	if finish {
-		return seq0, seq1, true
+func (sv SetVisibilityGameAction) Execute(c *Client, r *Room) {
+	if c != r.Master {
+		c.Send(SetVisibilityResponse{ShouldSet: false, Public: r.Public})
+		return
 	}
-	for i := 1; i < int(roll); i += 1 {
-		cell, finish := getNextPassingCell(prev_cell, seq0[i-1])
-		prev_cell = seq0[i-1]
-		seq0 = append(seq0, cell)
-		if finish {
-			return seq0, seq1, true
-		}
+	r.Public = sv.Public
+	err := r.Broadcast(SetVisibilityResponse{ShouldSet: true, Public: sv.Public})
+	if err != nil {
+		log.Println(err)
+	}
+}
+
+type PromoteSpectatorGameAction struct {
+	Spectator ClientID
+}
+
+func (ps PromoteSpectatorGameAction) Execute(c *Client, r *Room) {
+	instance := r.GameInstance
+	idx := r.GetSpectatorIndex(ps.Spectator)
+	if instance.GameState != GameStateGameEnded || c != r.Master || idx == -1 || len(instance.Players) == MaxPlayerCountInRoom {
+		c.Send(PromoteSpectatorResponse{ShouldPromote: false})
+		return
+	}
+	spectator := r.Spectators[idx]
+	r.Spectators = slices.Delete(r.Spectators, idx, idx+1)
+	team := instance.SmallestTeam()
+	instance.Players = append(instance.Players, PlayerState{Client: spectator.Client, Name: spectator.Name, Team: team})
+	err := r.Broadcast(PromoteSpectatorResponse{
+		ShouldPromote: true,
+		Player:        spectator.Client.ID,
+		Name:          spectator.Name,
+		Team:          team,
+	})
+	if err != nil {
+		log.Println(err)
 	}
-	return seq0, seq1, false
 }
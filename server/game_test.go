@@ -0,0 +1,87 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"log"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/AdventurerAmer/yutnori/rules"
+)
+
+func TestFullFinishingOrder(t *testing.T) {
+	hub := newTestHub(t, Config{})
+	a, b, c := connect(t, hub, "a"), connect(t, hub, "b"), connect(t, hub, "c")
+	clients := []*testClient{a, b, c}
+	newRoom(t, clients...)
+	a.send(MessageTypeSetPieceCount, map[string]any{"piece_count": 2})
+	a.send(MessageTypeSetRuleSet, map[string]any{"rules": rules.RuleSet{FullFinishingOrder: true}})
+	set := SetRuleSetResponse{}
+	c.expect(MessageTypeSetRuleSet, &set)
+	if !set.ShouldSet || !set.Rules.FullFinishingOrder {
+		t.Fatalf("got %+v", set)
+	}
+	startGame(t, clients...)
+
+	finished := TeamFinishedResponse{}
+	decode(t, play(t, a, clients, is(MessageTypeTeamFinished)), &finished)
+	if finished.Place != 0 || len(finished.Players) != 1 {
+		t.Errorf("got %+v", finished)
+	}
+	end := EndGameResponse{}
+	decode(t, play(t, a, clients, is(MessageTypeEndGame)), &end)
+	if len(end.Ranking) != 3 || end.Ranking[0][0] != finished.Players[0] || end.Winner != finished.Players[0] || end.WinningTeam != finished.Team {
+		t.Errorf("got %+v after %+v", end, finished)
+	}
+}
+
+// logBuffer collects the log of the rooms, which write from their own
+// goroutines.
+type logBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *logBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *logBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+func TestSeedLogging(t *testing.T) {
+	logs := &logBuffer{}
+	log.SetOutput(logs)
+	t.Cleanup(func() {
+		log.SetOutput(io.Discard)
+	})
+	hub := newTestHub(t, Config{})
+	a, b := connect(t, hub, "a"), connect(t, hub, "b")
+	newRoom(t, a, b)
+	a.send(MessageTypeSetFairMode, map[string]any{"fair": true})
+	b.expect(MessageTypeSetFairMode, nil)
+
+	// the seed would predict every throw of the game
+	first := startGame(t, a, b)
+	a.sync()
+	if text := logs.String(); !strings.Contains(text, "started a game") || strings.Contains(text, "seed") {
+		t.Errorf("got log:\n%s", text)
+	}
+	roller := a
+	if first == b.ID {
+		roller = b
+	}
+	roller.send(MessageTypeBeginRoll, nil)
+	play(t, a, []*testClient{a, b}, is(MessageTypeRevealSeed))
+	a.sync()
+	if text := logs.String(); !strings.Contains(text, "revealed the seed") {
+		t.Errorf("got log:\n%s", text)
+	}
+}
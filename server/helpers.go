@@ -3,10 +3,32 @@ package main
 import (
 	"crypto/rand"
 	"encoding/base32"
+	"encoding/binary"
 )
 
+const InviteCodeLength = 6
+
+// inviteCodeAlphabet leaves out the characters that are easy to mistake for
+// one another, like 0 and O or 1 and I.
+const inviteCodeAlphabet = "ABCDEFGHJKLMNPQRSTUVWXYZ23456789"
+
 func generateUUID() string {
 	b := make([]byte, 20)
 	rand.Read(b)
 	return base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString(b)
 }
+
+func generateInviteCode() string {
+	b := make([]byte, InviteCodeLength)
+	rand.Read(b)
+	for idx := range b {
+		b[idx] = inviteCodeAlphabet[int(b[idx])%len(inviteCodeAlphabet)]
+	}
+	return string(b)
+}
+
+func generateSeed() int64 {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return int64(binary.BigEndian.Uint64(b))
+}
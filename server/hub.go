@@ -1,36 +1,108 @@
 package main
 
 import (
+	"cmp"
 	"log"
 	"net"
+	"slices"
+	"strings"
+	"sync"
 )
 
+const RoomStateLobby = "lobby"
+const RoomStateInGame = "in_game"
+const DefaultRoomPageSize = 20
+const MaxRoomPageSize = 50
+
 type CreateRoomParams struct {
 	Client     *Client
 	ClientName string
+	Password   string
 }
 
+// EnterRoomParams names the room either by its ID or by its invite code.
 type EnterRoomParams struct {
 	Client     *Client
 	ClientName string
 	Room       RoomID
+	InviteCode string
+	Password   string
+	Spectate   bool
+}
+
+// RoomFilter selects rooms of the listing, zero values match every room.
+type RoomFilter struct {
+	State      string
+	PieceCount uint8
+	NotFull    bool
+	Master     string
+	NoBots     bool
+	Page       int
+	PageSize   int
+}
+
+func (f RoomFilter) Match(info RoomInfo) bool {
+	if f.State == RoomStateLobby && info.InGame || f.State == RoomStateInGame && !info.InGame {
+		return false
+	}
+	if f.PieceCount != 0 && f.PieceCount != info.PieceCount {
+		return false
+	}
+	if f.NotFull && info.PlayerCount >= MaxPlayerCountInRoom {
+		return false
+	}
+	if f.Master != "" && !strings.Contains(strings.ToLower(info.MasterName), strings.ToLower(f.Master)) {
+		return false
+	}
+	if f.NoBots && info.BotCount != 0 {
+		return false
+	}
+	return true
+}
+
+type ListRoomsParams struct {
+	Client *Client
+	Filter RoomFilter
 }
 
 type Hub struct {
+	Config           Config
 	RegisterClientCh chan net.Conn
 	Rooms            map[RoomID]*Room
+	InviteCodes      map[string]*Room
 	CreateRoomCh     chan CreateRoomParams
 	EnterRoomCh      chan EnterRoomParams
 	DestroyRoomCh    chan *Room
+	ListRoomsCh      chan ListRoomsParams
+	JoinQueueCh      chan JoinQueueParams
+	LeaveQueueCh     chan *Client
+	RequeueCh        chan []QueueEntry
+	Queue            []QueueEntry
+
+	// sessions are guarded by a mutex rather than owned by HandleClients,
+	// rooms end sessions from their own loop and must not block on the hub.
+	sessionsMu sync.Mutex
+	sessions   map[string]*Client
+
+	identitiesMu sync.Mutex
+	identities   map[string]int // identities created by each remote host
 }
 
-func NewHub() *Hub {
+func NewHub(cfg Config) *Hub {
 	return &Hub{
+		Config:           cfg,
 		Rooms:            make(map[RoomID]*Room),
+		InviteCodes:      make(map[string]*Room),
 		RegisterClientCh: make(chan net.Conn),
 		CreateRoomCh:     make(chan CreateRoomParams),
 		EnterRoomCh:      make(chan EnterRoomParams),
 		DestroyRoomCh:    make(chan *Room),
+		ListRoomsCh:      make(chan ListRoomsParams),
+		JoinQueueCh:      make(chan JoinQueueParams),
+		LeaveQueueCh:     make(chan *Client),
+		RequeueCh:        make(chan []QueueEntry),
+		sessions:         make(map[string]*Client),
+		identities:       make(map[string]int),
 	}
 }
 
@@ -42,38 +114,83 @@ func (h *Hub) HandleClients() {
 				return
 			}
 			client := NewClient(conn)
-			if err := client.Send(ConnectResponse{ClientID: client.ID}); err != nil {
+			if err := client.Send(ConnectResponse{ClientID: client.ID, SessionToken: client.SessionToken}); err != nil {
 				break
 			}
+			h.AddSession(client)
 			go client.ReadLoop(h)
 			go client.WriteLoop(h)
 		case params := <-h.CreateRoomCh:
-			room := NewRoom(params.Client, params.ClientName)
-			err := params.Client.Send(CreateRoomResponse{RoomID: room.ID})
+			if h.leaveQueue(params.Client) {
+				h.sendQueueStatus()
+			}
+			room := h.newRoom(params.Client, params.ClientName)
+			room.Password = params.Password
+			err := params.Client.Send(CreateRoomResponse{RoomID: room.ID, InviteCode: room.InviteCode})
 			if err != nil {
 				log.Println(err)
 				break
 			}
-			h.Rooms[room.ID] = room
 			params.Client.EnterRoom(room)
-			go room.ReadLoop(h)
-			log.Printf("created room '%s'\n", room.ID)
+			h.addRoom(room)
 		case params := <-h.EnterRoomCh:
 			client := params.Client
+			if h.leaveQueue(client) {
+				h.sendQueueStatus()
+			}
 			room := h.Rooms[params.Room]
-			log.Printf("client '%s' wants to enter room '%s'\n", client.ID, params.Room)
+			if params.InviteCode != "" {
+				room = h.InviteCodes[strings.ToUpper(params.InviteCode)]
+				log.Printf("client '%s' wants to enter room with invite code '%s'\n", client.ID, params.InviteCode)
+			} else {
+				log.Printf("client '%s' wants to enter room '%s'\n", client.ID, params.Room)
+			}
 			if room == nil {
-				client.Send(JoinRoomResponse{})
+				client.Send(JoinRoomResponse{Reason: "room not found"})
 			} else {
-				room.Enter(client, params.ClientName)
+				room.Enter(client, params.ClientName, params.Password, params.Spectate)
 			}
 		case room := <-h.DestroyRoomCh:
 			delete(h.Rooms, room.ID)
+			delete(h.InviteCodes, room.InviteCode)
 			log.Printf("destroyed room '%s'\n", room.ID)
+		case params := <-h.JoinQueueCh:
+			h.joinQueue(params)
+		case entries := <-h.RequeueCh:
+			h.requeue(entries)
+		case client := <-h.LeaveQueueCh:
+			left := h.leaveQueue(client)
+			client.Send(LeaveQueueResponse{Left: left})
+			if left {
+				h.sendQueueStatus()
+			}
+		case params := <-h.ListRoomsCh:
+			err := params.Client.Send(h.listRooms(params.Filter))
+			if err != nil {
+				log.Println(err)
+			}
 		}
 	}
 }
 
+func (h *Hub) newRoom(master *Client, masterName string) *Room {
+	room := NewRoom(master, masterName)
+	room.InviteCode = h.newInviteCode()
+	room.ReplayDir = h.Config.ReplayDir
+	room.ReconnectGrace = h.Config.ReconnectGrace
+	room.BotDeadline = h.Config.BotDeadline
+	room.ChatFilter = h.Config.ChatFilter
+	room.Ratings = h.Config.Ratings
+	return room
+}
+
+func (h *Hub) addRoom(room *Room) {
+	h.Rooms[room.ID] = room
+	h.InviteCodes[room.InviteCode] = room
+	go room.ReadLoop(h)
+	log.Printf("created room '%s'\n", room.ID)
+}
+
 func (h *Hub) RegisterClient(conn net.Conn) {
 	if h == nil {
 		return
@@ -81,18 +198,28 @@ func (h *Hub) RegisterClient(conn net.Conn) {
 	h.RegisterClientCh <- conn
 }
 
-func (h *Hub) CreateRoom(client *Client, clientName string) {
+func (h *Hub) CreateRoom(client *Client, clientName string, password string) {
 	if h == nil {
 		return
 	}
-	h.CreateRoomCh <- CreateRoomParams{Client: client, ClientName: clientName}
+	h.CreateRoomCh <- CreateRoomParams{Client: client, ClientName: clientName, Password: password}
 }
 
-func (h *Hub) EnterRoom(client *Client, clientName string, room RoomID) {
+func (h *Hub) EnterRoom(params EnterRoomParams) {
 	if h == nil {
 		return
 	}
-	h.EnterRoomCh <- EnterRoomParams{Client: client, ClientName: clientName, Room: room}
+	h.EnterRoomCh <- params
+}
+
+// newInviteCode draws codes until one is not used by another room.
+func (h *Hub) newInviteCode() string {
+	for {
+		code := generateInviteCode()
+		if _, ok := h.InviteCodes[code]; !ok {
+			return code
+		}
+	}
 }
 
 func (h *Hub) DestroyRoom(room *Room) {
@@ -101,3 +228,101 @@ func (h *Hub) DestroyRoom(room *Room) {
 	}
 	h.DestroyRoomCh <- room
 }
+
+func (h *Hub) ListRooms(client *Client, filter RoomFilter) {
+	if h == nil {
+		return
+	}
+	h.ListRoomsCh <- ListRoomsParams{Client: client, Filter: filter}
+}
+
+// listRooms pages through the public rooms matching the filter, oldest first.
+func (h *Hub) listRooms(filter RoomFilter) ListRoomsResponse {
+	infos := []RoomInfo{}
+	for _, room := range h.Rooms {
+		info := room.Info()
+		if info.Public && filter.Match(info) {
+			infos = append(infos, info)
+		}
+	}
+	slices.SortFunc(infos, func(a, b RoomInfo) int {
+		return cmp.Or(a.CreatedAt.Compare(b.CreatedAt), strings.Compare(string(a.ID), string(b.ID)))
+	})
+	start := min(min(filter.Page, len(infos))*filter.PageSize, len(infos))
+	end := min(start+filter.PageSize, len(infos))
+	rooms := []RoomListing{}
+	for _, info := range infos[start:end] {
+		state := RoomStateLobby
+		if info.InGame {
+			state = RoomStateInGame
+		}
+		rooms = append(rooms, RoomListing{
+			RoomID:         info.ID,
+			MasterName:     info.MasterName,
+			Password:       info.Password,
+			PlayerCount:    info.PlayerCount,
+			MaxPlayerCount: MaxPlayerCountInRoom,
+			SpectatorCount: info.SpectatorCount,
+			BotCount:       info.BotCount,
+			PieceCount:     info.PieceCount,
+			TeamCount:      info.TeamCount,
+			State:          state,
+		})
+	}
+	return ListRoomsResponse{Rooms: rooms, Page: filter.Page, PageSize: filter.PageSize, Total: len(infos)}
+}
+
+func (h *Hub) AddSession(client *Client) {
+	h.sessionsMu.Lock()
+	defer h.sessionsMu.Unlock()
+	h.sessions[client.SessionToken] = client
+}
+
+func (h *Hub) FindSession(token string) *Client {
+	h.sessionsMu.Lock()
+	defer h.sessionsMu.Unlock()
+	return h.sessions[token]
+}
+
+func (h *Hub) EndSession(token string) {
+	h.sessionsMu.Lock()
+	defer h.sessionsMu.Unlock()
+	delete(h.sessions, token)
+}
+
+// EndClientSession ends the session of client unless another client took it
+// over. The token is read under the lock TakeOverSession rewrites it with.
+func (h *Hub) EndClientSession(client *Client) {
+	h.sessionsMu.Lock()
+	defer h.sessionsMu.Unlock()
+	if h.sessions[client.SessionToken] == client {
+		delete(h.sessions, client.SessionToken)
+	}
+}
+
+// TakeOverSession gives client the ID and the session of the client it
+// replaces, its own session ends.
+func (h *Hub) TakeOverSession(client *Client, session *Client) {
+	h.sessionsMu.Lock()
+	defer h.sessionsMu.Unlock()
+	delete(h.sessions, client.SessionToken)
+	client.ID = session.ID
+	client.SessionToken = session.SessionToken
+	h.sessions[client.SessionToken] = client
+}
+
+// AllowIdentity counts an identity created by the host conn comes from, it
+// reports false once the host created MaxIdentitiesPerHost of them.
+func (h *Hub) AllowIdentity(conn net.Conn) bool {
+	host := conn.RemoteAddr().String()
+	if split, _, err := net.SplitHostPort(host); err == nil {
+		host = split
+	}
+	h.identitiesMu.Lock()
+	defer h.identitiesMu.Unlock()
+	if h.identities[host] == MaxIdentitiesPerHost {
+		return false
+	}
+	h.identities[host]++
+	return true
+}
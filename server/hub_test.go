@@ -0,0 +1,156 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRoomFilterMatch(t *testing.T) {
+	info := RoomInfo{MasterName: "Alice", PlayerCount: 2, PieceCount: 4}
+	full := info
+	full.PlayerCount = MaxPlayerCountInRoom
+	inGame := info
+	inGame.InGame = true
+	withBots := info
+	withBots.BotCount = 1
+	tests := []struct {
+		name   string
+		filter RoomFilter
+		info   RoomInfo
+		match  bool
+	}{
+		{"no filter", RoomFilter{}, info, true},
+		{"lobby", RoomFilter{State: RoomStateLobby}, info, true},
+		{"lobby in game", RoomFilter{State: RoomStateLobby}, inGame, false},
+		{"in game", RoomFilter{State: RoomStateInGame}, inGame, true},
+		{"in game lobby", RoomFilter{State: RoomStateInGame}, info, false},
+		{"pieces", RoomFilter{PieceCount: 4}, info, true},
+		{"other pieces", RoomFilter{PieceCount: 3}, info, false},
+		{"not full", RoomFilter{NotFull: true}, info, true},
+		{"full", RoomFilter{NotFull: true}, full, false},
+		{"master", RoomFilter{Master: "lic"}, info, true},
+		{"master case", RoomFilter{Master: "ALI"}, info, true},
+		{"other master", RoomFilter{Master: "bob"}, info, false},
+		{"no bots", RoomFilter{NoBots: true}, info, true},
+		{"bots", RoomFilter{NoBots: true}, withBots, false},
+	}
+	for _, test := range tests {
+		if match := test.filter.Match(test.info); match != test.match {
+			t.Errorf("%s: got %v", test.name, match)
+		}
+	}
+}
+
+func TestListRooms(t *testing.T) {
+	hub := NewHub(Config{})
+	start := time.Now()
+	for idx := range 5 {
+		id := RoomID(fmt.Sprintf("room%d", idx))
+		hub.Rooms[id] = &Room{info: RoomInfo{
+			ID:          id,
+			Public:      idx != 2,
+			MasterName:  "master",
+			PlayerCount: 1,
+			PieceCount:  uint8(2 + idx%2),
+			InGame:      idx == 3,
+			CreatedAt:   start.Add(time.Duration(idx) * time.Second),
+		}}
+	}
+
+	tests := []struct {
+		name   string
+		filter RoomFilter
+		rooms  []RoomID
+		total  int
+	}{
+		{"first page", RoomFilter{PageSize: 2}, []RoomID{"room0", "room1"}, 4},
+		{"second page", RoomFilter{Page: 1, PageSize: 2}, []RoomID{"room3", "room4"}, 4},
+		{"past the end", RoomFilter{Page: 5, PageSize: 2}, []RoomID{}, 4},
+		{"filtered", RoomFilter{PieceCount: 3, PageSize: 10}, []RoomID{"room1", "room3"}, 2},
+		{"lobby", RoomFilter{State: RoomStateLobby, PageSize: 10}, []RoomID{"room0", "room1", "room4"}, 3},
+	}
+	for _, test := range tests {
+		resp := hub.listRooms(test.filter)
+		rooms := []RoomID{}
+		for _, room := range resp.Rooms {
+			rooms = append(rooms, room.RoomID)
+		}
+		if fmt.Sprint(rooms) != fmt.Sprint(test.rooms) || resp.Total != test.total {
+			t.Errorf("%s: got %v of %d", test.name, rooms, resp.Total)
+		}
+	}
+	resp := hub.listRooms(RoomFilter{Page: 1, PageSize: 2})
+	if resp.Rooms[0].State != RoomStateInGame || resp.Rooms[1].State != RoomStateLobby || resp.Rooms[0].MaxPlayerCount != MaxPlayerCountInRoom {
+		t.Errorf("got %+v", resp.Rooms)
+	}
+}
+
+func TestSetVisibility(t *testing.T) {
+	hub := newTestHub(t, Config{})
+	a, b, c := connect(t, hub, "alice"), connect(t, hub, "b"), connect(t, hub, "c")
+	room := newRoom(t, a, b)
+
+	list := func() ListRoomsResponse {
+		c.send(MessageTypeListRooms, map[string]any{"master": "ali"})
+		resp := ListRoomsResponse{}
+		c.expect(MessageTypeListRooms, &resp)
+		return resp
+	}
+	if resp := list(); len(resp.Rooms) != 0 || resp.PageSize != DefaultRoomPageSize {
+		t.Errorf("a private room is listed: %+v", resp)
+	}
+
+	b.send(MessageTypeSetVisibility, map[string]any{"public": true})
+	resp := SetVisibilityResponse{}
+	b.expect(MessageTypeSetVisibility, &resp)
+	if resp.ShouldSet {
+		t.Error("a player who is not the master made the room public")
+	}
+
+	a.send(MessageTypeSetVisibility, map[string]any{"public": true})
+	b.expect(MessageTypeSetVisibility, &resp)
+	if !resp.ShouldSet || !resp.Public {
+		t.Errorf("got %+v", resp)
+	}
+	a.sync()
+	listed := list()
+	if len(listed.Rooms) != 1 || listed.Rooms[0].RoomID != room || listed.Rooms[0].PlayerCount != 2 || listed.Rooms[0].MasterName != "alice" {
+		t.Errorf("got %+v", listed)
+	}
+}
+
+func TestGenerateInviteCode(t *testing.T) {
+	for range 100 {
+		code := generateInviteCode()
+		if len(code) != InviteCodeLength || strings.Trim(code, inviteCodeAlphabet) != "" {
+			t.Fatalf("got invite code %q", code)
+		}
+	}
+}
+
+func TestInviteCode(t *testing.T) {
+	hub := newTestHub(t, Config{})
+	a, b, c := connect(t, hub, "a"), connect(t, hub, "b"), connect(t, hub, "c")
+	a.send(MessageTypeCreateRoom, map[string]any{"name": "a"})
+	created := CreateRoomResponse{}
+	a.expect(MessageTypeCreateRoom, &created)
+	if len(created.InviteCode) != InviteCodeLength {
+		t.Fatalf("got invite code %q", created.InviteCode)
+	}
+
+	b.send(MessageTypeEnterRoom, map[string]any{"invite_code": strings.ToLower(created.InviteCode), "name": "b"})
+	joined := JoinRoomResponse{}
+	b.expect(MessageTypeEnterRoom, &joined)
+	if !joined.Join || joined.RoomID != created.RoomID || joined.InviteCode != created.InviteCode {
+		t.Errorf("got %+v", joined)
+	}
+
+	c.send(MessageTypeEnterRoom, map[string]any{"invite_code": "NOPE22", "name": "c"})
+	joined = JoinRoomResponse{}
+	c.expect(MessageTypeEnterRoom, &joined)
+	if joined.Join || joined.Reason != "room not found" {
+		t.Errorf("got %+v", joined)
+	}
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"log"
+	"slices"
+
+	"github.com/AdventurerAmer/yutnori/bot"
+)
+
+// LeaveAction is what happens to the seat of a player who leaves during a
+// game, or whose reconnect grace period runs out.
+type LeaveAction string
+
+const (
+	LeaveReset   LeaveAction = "reset" // the game is abandoned
+	LeaveBot     LeaveAction = "bot"   // a bot takes the seat over
+	LeaveForfeit LeaveAction = "forfeit"
+)
+
+// ReplacementDifficulty is the difficulty of a bot taking a seat over.
+const ReplacementDifficulty = bot.Medium
+
+func ParseLeaveAction(action string) (LeaveAction, bool) {
+	switch LeaveAction(action) {
+	case LeaveReset, LeaveBot, LeaveForfeit:
+		return LeaveAction(action), true
+	}
+	return LeaveReset, false
+}
+
+// humanSeats lists the seats that are not played by bots.
+func (g *GameInstance) humanSeats() []int {
+	seats := []int{}
+	for idx, p := range g.Players {
+		if !p.Client.Bot {
+			seats = append(seats, idx)
+		}
+	}
+	return seats
+}
+
+// canKeepPlaying reports whether the game can go on without the player at
+// idx, the room needs a player left who is not a bot.
+func (r *Room) canKeepPlaying(idx int, action LeaveAction) bool {
+	if action == LeaveReset || r.GameInstance.GameState == GameStateGameEnded {
+		return false
+	}
+	return slices.ContainsFunc(r.GameInstance.humanSeats(), func(seat int) bool {
+		return seat != idx
+	})
+}
+
+// leaveGame hands the seat of a leaving player to a bot client, which either
+// plays on or only holds the seat of a forfeited player until the game ends.
+func leaveGame(r *Room, idx int, kicked bool, action LeaveAction) error {
+	g := r.GameInstance
+	player := &g.Players[idx]
+	old, disconnected := player.Client, player.Disconnected
+	client := NewBotClient()
+	g.ReplaceClient(old, client)
+	player.Client = client
+	player.Leaver = old.Identity()
+	player.Disconnected = false
+	player.GraceTimer = nil
+	if r.Master == old {
+		humans := g.humanSeats()
+		r.Master = g.Players[humans[g.BotRand.Intn(len(humans))]].Client
+	}
+	left := PlayerLeftResponse{Master: r.Master.ID, Player: old.ID, Kicked: kicked}
+	err := r.Broadcast(left)
+	if err != nil {
+		return err
+	}
+	// the seat is no longer theirs, a kicked player learns it from this too
+	if kicked && !disconnected {
+		old.Send(left)
+	}
+
+	if action == LeaveBot {
+		player.Bot = ReplacementDifficulty
+		log.Printf("a bot took the seat of client '%s' over\n", old.ID)
+		err = r.Broadcast(PlayerReplacedResponse{Player: old.ID, Bot: client.ID, Difficulty: player.Bot})
+		if err != nil {
+			log.Println(err)
+		}
+		if g.State.Turn == idx {
+			g.playBot(r)
+		}
+	} else {
+		player.Left = true
+		// the move being shown is made first, the forfeit would drop it
+		if g.GameState == GameStateBeginMove {
+			events, err := g.State.ApplyMove(g.CurrentMove)
+			if err != nil {
+				return err
+			}
+			g.BroadcastEvents(r, events)
+			if g.GameState == GameStateGameEnded {
+				return nil
+			}
+		}
+		events, err := g.State.Forfeit(idx)
+		if err != nil {
+			return err
+		}
+		g.BroadcastEvents(r, events)
+	}
+	g.ackBotMoves()
+	g.TryEndMove(r)
+	return nil
+}
+
+// dropLeftSeats frees the seats held for players who left during the game,
+// the final state goes with them as it no longer matches the seats.
+func (g *GameInstance) dropLeftSeats() {
+	count := len(g.Players)
+	g.Players = slices.DeleteFunc(g.Players, func(p PlayerState) bool {
+		return p.Left
+	})
+	if len(g.Players) != count {
+		g.State = nil
+	}
+}
+
+type SetLeaveActionGameAction struct {
+	LeaveAction LeaveAction
+}
+
+func (s SetLeaveActionGameAction) Execute(c *Client, r *Room) {
+	if r.GameInstance.GameState != GameStateGameEnded || c != r.Master {
+		c.Send(SetLeaveActionResponse{ShouldSet: false, LeaveAction: r.LeaveAction})
+		return
+	}
+	r.LeaveAction = s.LeaveAction
+	err := r.Broadcast(SetLeaveActionResponse{ShouldSet: true, LeaveAction: s.LeaveAction})
+	if err != nil {
+		log.Println(err)
+	}
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/AdventurerAmer/yutnori/bot"
+)
+
+func setLeaveAction(c *testClient, action LeaveAction) SetLeaveActionResponse {
+	c.t.Helper()
+	c.send(MessageTypeSetLeaveAction, map[string]any{"leave_action": action})
+	resp := SetLeaveActionResponse{}
+	c.expect(MessageTypeSetLeaveAction, &resp)
+	return resp
+}
+
+func TestSetLeaveAction(t *testing.T) {
+	hub := newTestHub(t, Config{})
+	a, b := connect(t, hub, "a"), connect(t, hub, "b")
+	room := newRoom(t, a, b)
+
+	if resp := setLeaveAction(b, LeaveBot); resp.ShouldSet || resp.LeaveAction != LeaveReset {
+		t.Errorf("a player who is not the master set the leave action: %+v", resp)
+	}
+	if resp := setLeaveAction(a, "vanish"); resp.ShouldSet {
+		t.Errorf("set an unknown leave action: %+v", resp)
+	}
+	if resp := setLeaveAction(a, LeaveForfeit); !resp.ShouldSet || resp.LeaveAction != LeaveForfeit {
+		t.Errorf("got %+v", resp)
+	}
+	resp := SetLeaveActionResponse{}
+	b.expect(MessageTypeSetLeaveAction, &resp)
+	if resp.LeaveAction != LeaveForfeit {
+		t.Errorf("got %+v", resp)
+	}
+
+	c := connect(t, hub, "c")
+	if joined := enterRoom(t, c, room); joined.LeaveAction != LeaveForfeit {
+		t.Errorf("got %s", joined.LeaveAction)
+	}
+}
+
+func TestLeaveBot(t *testing.T) {
+	hub := newTestHub(t, Config{})
+	a, b, c := connect(t, hub, "a"), connect(t, hub, "b"), connect(t, hub, "c")
+	newRoom(t, a, b, c)
+	setLeaveAction(a, LeaveBot)
+	startGame(t, a, b, c)
+	c.send(MessageTypeExitRoom, nil)
+
+	// the bot rolls for the seat of the player who left
+	replaced := PlayerReplacedResponse{}
+	caller := ClientID("")
+	play(t, a, []*testClient{a, b}, func(msg Message) bool {
+		switch msg.Kind {
+		case MessageTypePlayerLeft:
+			left := PlayerLeftResponse{}
+			decode(t, msg, &left)
+			if left.Player != c.ID {
+				t.Errorf("got %+v", left)
+			}
+		case MessageTypePlayerReplaced:
+			decode(t, msg, &replaced)
+			if replaced.Player != c.ID || replaced.Difficulty != bot.Medium {
+				t.Errorf("got %+v", replaced)
+			}
+		case MessageTypeCanRoll:
+			call := CallRollResponse{}
+			json.Unmarshal(msg.Payload, &call)
+			caller = call.Player
+		case MessageTypeEndRoll:
+			return replaced.Bot != "" && (caller == c.ID || caller == replaced.Bot)
+		case MessageTypeEndGame:
+			t.Fatal("the game ended")
+		}
+		return false
+	})
+}
+
+func TestLeaveForfeit(t *testing.T) {
+	hub := newTestHub(t, Config{})
+	a, b, c := connect(t, hub, "a"), connect(t, hub, "b"), connect(t, hub, "c")
+	room := newRoom(t, a, b, c)
+	setLeaveAction(a, LeaveForfeit)
+	startGame(t, a, b, c)
+	c.send(MessageTypeExitRoom, nil)
+
+	forfeited := PlayerForfeitedResponse{}
+	decode(t, play(t, a, []*testClient{a, b}, is(MessageTypePlayerForfeited)), &forfeited)
+	// the forfeit is made by the bot client holding the seat
+	if forfeited.Player == a.ID || forfeited.Player == b.ID || forfeited.Team != 2 || !forfeited.TeamOut {
+		t.Errorf("got %+v", forfeited)
+	}
+	end := EndGameResponse{}
+	decode(t, play(t, a, []*testClient{a, b}, is(MessageTypeEndGame)), &end)
+	if end.Winner != a.ID && end.Winner != b.ID {
+		t.Errorf("got winner %s", end.Winner)
+	}
+
+	// the seat is freed once the game ends
+	d := connect(t, hub, "d")
+	if joined := enterRoom(t, d, room); len(joined.Players) != 2 {
+		t.Errorf("got players %+v", joined.Players)
+	}
+}
+
+func TestLeaveForfeitDuringMove(t *testing.T) {
+	hub := newTestHub(t, Config{})
+	a, b, c := connect(t, hub, "a"), connect(t, hub, "b"), connect(t, hub, "c")
+	newRoom(t, a, b, c)
+	setLeaveAction(a, LeaveForfeit)
+	startGame(t, a, b, c)
+	move := BeginMoveRespone{}
+	decode(t, play(t, a, []*testClient{a, b, c}, func(msg Message) bool {
+		if msg.Kind != MessageTypeBeginMove {
+			return false
+		}
+		resp := BeginMoveRespone{}
+		decode(t, msg, &resp)
+		return resp.ShouldMove && resp.Player != c.ID
+	}), &move)
+
+	// the move being shown is made before the seat is forfeited
+	c.send(MessageTypeExitRoom, nil)
+	a.expect(MessageTypePlayerForfeited, nil)
+	a.send(MessageTypeGameSnapshot, nil)
+	snapshot := GameSnapshot{}
+	a.expect(MessageTypeGameSnapshot, &snapshot)
+	if snapshot.GameState == GameStateBeginMove {
+		t.Fatal("the move is still pending")
+	}
+	for _, p := range snapshot.Players {
+		if p.ClientID != move.Player {
+			continue
+		}
+		piece := p.Pieces[move.Piece]
+		if piece.IsFinished != move.Finished || !move.Finished && int(piece.Cell) != move.Path[len(move.Path)-1] {
+			t.Errorf("got piece %+v after %+v", piece, move)
+		}
+	}
+}
@@ -5,10 +5,18 @@ import (
 	"fmt"
 	"log"
 	"net"
+	"time"
+
+	"github.com/AdventurerAmer/yutnori/rating"
 )
 
 type Config struct {
-	Port int
+	Port           int
+	ReplayDir      string
+	ReconnectGrace time.Duration
+	BotDeadline    time.Duration // longest a client in bot mode may take to move, zero means no limit
+	ChatFilter     *ChatFilter
+	Ratings        *rating.Store // nil disables identities and ratings
 }
 
 type Server struct {
@@ -30,7 +38,7 @@ func (s *Server) Start() error {
 	}
 	defer ln.Close()
 
-	hub := NewHub()
+	hub := NewHub(s.Config)
 	go hub.HandleClients()
 
 	for {
@@ -48,9 +56,25 @@ func main() {
 
 	cfg := Config{}
 	flag.IntVar(&cfg.Port, "port", 42069, "port of the server")
+	flag.DurationVar(&cfg.ReconnectGrace, "reconnect-grace", time.Minute, "how long a disconnected player's seat is held during a game")
+	flag.DurationVar(&cfg.BotDeadline, "bot-deadline", 5*time.Second, "longest a client in bot mode may take to select a move")
+	flag.StringVar(&cfg.ReplayDir, "replays", "replays", "directory finished games are saved to, empty disables replays")
+	chatFilter := flag.String("chat-filter", "", "file of words masked in chat, one per line")
+	ratings := flag.String("ratings", "ratings.json", "file player identities and ratings are stored in, empty disables ratings")
 	flag.Parse()
+	var err error
+	cfg.ChatFilter, err = LoadChatFilter(*chatFilter)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if *ratings != "" {
+		cfg.Ratings, err = rating.Open(*ratings)
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
 	srv := NewServer(cfg)
-	err := srv.Start()
+	err = srv.Start()
 	if err != nil {
 		log.Fatal(err)
 	}
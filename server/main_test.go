@@ -0,0 +1,283 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"io"
+	"log"
+	"net"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestMain(m *testing.M) {
+	log.SetOutput(io.Discard)
+	os.Exit(m.Run())
+}
+
+// testTimeout bounds every wait for the server, a healthy server answers in
+// milliseconds.
+const testTimeout = 5 * time.Second
+
+// testClient is the client side of a connection to a hub under test, the
+// messages the server sends are queued until the test reads them.
+type testClient struct {
+	t        *testing.T
+	client   *Client // the server side of the connection
+	conn     net.Conn
+	messages chan Message
+	ID       ClientID
+	Token    string
+	Name     string
+}
+
+func newTestHub(t *testing.T, cfg Config) *Hub {
+	t.Helper()
+	hub := NewHub(cfg)
+	go hub.HandleClients()
+	return hub
+}
+
+func connect(t *testing.T, hub *Hub, name string) *testClient {
+	t.Helper()
+	server, conn := net.Pipe()
+	c := &testClient{t: t, conn: conn, messages: make(chan Message, 4096), Name: name}
+	go func() {
+		defer close(c.messages)
+		for {
+			msg, err := ReadMessage(conn)
+			if err != nil {
+				return
+			}
+			c.messages <- msg
+		}
+	}()
+	t.Cleanup(func() { conn.Close() })
+	hub.RegisterClient(server)
+	resp := ConnectResponse{}
+	c.expect(MessageTypeConnect, &resp)
+	c.ID, c.Token = resp.ClientID, resp.SessionToken
+	timeout := time.After(testTimeout)
+	for c.client = hub.FindSession(c.Token); c.client == nil; c.client = hub.FindSession(c.Token) {
+		select {
+		case <-timeout:
+			t.Fatalf("%s: no session", name)
+		case <-time.After(time.Millisecond):
+		}
+	}
+	return c
+}
+
+// send writes a request, a nil payload sends no payload at all.
+func (c *testClient) send(kind MessageType, payload any) {
+	c.t.Helper()
+	var b []byte
+	if payload != nil {
+		var err error
+		b, err = json.Marshal(payload)
+		if err != nil {
+			c.t.Fatal(err)
+		}
+	}
+	var msg bytes.Buffer
+	msg.WriteByte(byte(kind))
+	binary.Write(&msg, binary.BigEndian, uint16(len(b)))
+	msg.Write(b)
+	_, err := c.conn.Write(msg.Bytes())
+	if err != nil {
+		c.t.Fatal(err)
+	}
+}
+
+// until returns the messages received before the first one of kind, which
+// is decoded into v unless v is nil.
+func (c *testClient) until(kind MessageType, v any) []Message {
+	c.t.Helper()
+	skipped := []Message{}
+	timeout := time.After(testTimeout)
+	for {
+		select {
+		case msg, ok := <-c.messages:
+			if !ok {
+				c.t.Fatalf("%s: connection closed waiting for message %d", c.Name, kind)
+			}
+			if msg.Kind != kind {
+				skipped = append(skipped, msg)
+				continue
+			}
+			if v != nil {
+				err := json.Unmarshal(msg.Payload, v)
+				if err != nil {
+					c.t.Fatal(err)
+				}
+			}
+			return skipped
+		case <-timeout:
+			c.t.Fatalf("%s: timed out waiting for message %d", c.Name, kind)
+		}
+	}
+}
+
+func (c *testClient) expect(kind MessageType, v any) {
+	c.t.Helper()
+	c.until(kind, v)
+}
+
+// sync waits until the room handled every request c sent so far, the
+// messages received in the meantime are returned.
+func (c *testClient) sync() []Message {
+	c.t.Helper()
+	c.send(MessageTypeChangeName, map[string]any{"name": c.Name})
+	for {
+		resp := ChangeNameResponse{}
+		skipped := c.until(MessageTypeChangeName, &resp)
+		if resp.Player == c.ID {
+			return skipped
+		}
+	}
+}
+
+// waitRoom waits until the server bound c to a room, which happens after c
+// is told it joined.
+func (c *testClient) waitRoom() {
+	c.t.Helper()
+	timeout := time.After(testTimeout)
+	for getRoom(c.client) == nil {
+		select {
+		case <-timeout:
+			c.t.Fatalf("%s: timed out waiting for the room", c.Name)
+		case <-time.After(time.Millisecond):
+		}
+	}
+}
+
+func decode(t *testing.T, msg Message, v any) {
+	t.Helper()
+	err := json.Unmarshal(msg.Payload, v)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func kinds(messages []Message) []MessageType {
+	kinds := []MessageType{}
+	for _, msg := range messages {
+		kinds = append(kinds, msg.Kind)
+	}
+	return kinds
+}
+
+func (c *testClient) close() {
+	c.conn.Close()
+}
+
+func createRoom(t *testing.T, master *testClient) RoomID {
+	t.Helper()
+	master.send(MessageTypeCreateRoom, map[string]any{"name": master.Name})
+	resp := CreateRoomResponse{}
+	master.expect(MessageTypeCreateRoom, &resp)
+	master.waitRoom()
+	return resp.RoomID
+}
+
+func enterRoom(t *testing.T, c *testClient, room RoomID) JoinRoomResponse {
+	t.Helper()
+	c.send(MessageTypeEnterRoom, map[string]any{"room_id": room, "name": c.Name})
+	resp := JoinRoomResponse{}
+	c.expect(MessageTypeEnterRoom, &resp)
+	if resp.Join {
+		c.waitRoom()
+	}
+	return resp
+}
+
+// newRoom puts the clients in a room, the first one is the master.
+func newRoom(t *testing.T, clients ...*testClient) RoomID {
+	t.Helper()
+	room := createRoom(t, clients[0])
+	for _, c := range clients[1:] {
+		resp := enterRoom(t, c, room)
+		if !resp.Join {
+			t.Fatalf("%s could not join", c.Name)
+		}
+	}
+	return room
+}
+
+// startGame readies every client and starts the game, it returns the first
+// player.
+func startGame(t *testing.T, clients ...*testClient) ClientID {
+	t.Helper()
+	for _, c := range clients {
+		c.send(MessageTypePlayerReady, map[string]any{"is_ready": true})
+		c.sync()
+	}
+	clients[0].send(MessageTypeStartGame, nil)
+	resp := StartGameResponse{}
+	for _, c := range clients {
+		c.expect(MessageTypeStartGame, &resp)
+		if !resp.ShouldStart {
+			t.Fatal("the game did not start")
+		}
+	}
+	return resp.StartingPlayer
+}
+
+// play drives a game from what observer receives: the player called to roll
+// rolls, the player selecting a move takes the first legal one and every
+// client acknowledges the moves. It returns the first message stop accepts.
+func play(t *testing.T, observer *testClient, clients []*testClient, stop func(Message) bool) Message {
+	t.Helper()
+	byID := map[ClientID]*testClient{}
+	for _, c := range clients {
+		byID[c.ID] = c
+	}
+	timeout := time.After(testTimeout)
+	for {
+		var msg Message
+		select {
+		case m, ok := <-observer.messages:
+			if !ok {
+				t.Fatalf("%s: connection closed", observer.Name)
+			}
+			msg = m
+		case <-timeout:
+			t.Fatal("timed out playing the game")
+		}
+		if stop(msg) {
+			return msg
+		}
+		switch msg.Kind {
+		case MessageTypeCanRoll:
+			resp := CallRollResponse{}
+			json.Unmarshal(msg.Payload, &resp)
+			if c := byID[resp.Player]; c != nil {
+				c.send(MessageTypeBeginRoll, nil)
+			}
+		case MessageTypeSelectingMove:
+			resp := SelectingMoveResponse{}
+			json.Unmarshal(msg.Payload, &resp)
+			if c := byID[resp.Player]; c != nil && len(resp.Moves) != 0 {
+				c.send(MessageTypeBeginMove, resp.Moves[0])
+			}
+		case MessageTypeBeginMove:
+			resp := BeginMoveRespone{}
+			json.Unmarshal(msg.Payload, &resp)
+			if !resp.ShouldMove {
+				break
+			}
+			for _, c := range clients {
+				c.send(MessageTypeEndMove, resp)
+			}
+		}
+	}
+}
+
+// is stops play at the first message of kind.
+func is(kind MessageType) func(Message) bool {
+	return func(msg Message) bool {
+		return msg.Kind == kind
+	}
+}
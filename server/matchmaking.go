@@ -0,0 +1,189 @@
+package main
+
+import (
+	"cmp"
+	"log"
+	"math"
+	"slices"
+
+	"github.com/AdventurerAmer/yutnori/rating"
+	"github.com/AdventurerAmer/yutnori/rules"
+)
+
+// QueuePreferences are what a client asks of a quick-play game, only clients
+// with equal preferences are matched together.
+type QueuePreferences struct {
+	PlayerCount int
+	PieceCount  uint8
+	Rules       rules.RuleSet
+}
+
+type QueueEntry struct {
+	Client      *Client
+	Name        string
+	Preferences QueuePreferences
+	Rating      float64
+}
+
+type JoinQueueParams struct {
+	Client      *Client
+	Name        string
+	Preferences QueuePreferences
+}
+
+func (h *Hub) JoinQueue(client *Client, name string, prefs QueuePreferences) {
+	if h == nil {
+		return
+	}
+	h.JoinQueueCh <- JoinQueueParams{Client: client, Name: name, Preferences: prefs}
+}
+
+// Requeue gives the clients of a match that fell through their place at the
+// front of the queue back.
+func (h *Hub) Requeue(entries []QueueEntry) {
+	if h == nil {
+		return
+	}
+	h.RequeueCh <- entries
+}
+
+func (h *Hub) LeaveQueue(client *Client) {
+	if h == nil {
+		return
+	}
+	h.LeaveQueueCh <- client
+}
+
+func (h *Hub) queueIndex(client *Client) int {
+	for idx, e := range h.Queue {
+		if e.Client == client {
+			return idx
+		}
+	}
+	return -1
+}
+
+// joinQueue puts the client at the back of the queue, a client that is
+// already queued loses its place.
+func (h *Hub) joinQueue(params JoinQueueParams) {
+	h.leaveQueue(params.Client)
+	entry := QueueEntry{Client: params.Client, Name: params.Name, Preferences: params.Preferences, Rating: rating.DefaultRating}
+	if h.Config.Ratings != nil {
+		entry.Rating = h.Config.Ratings.Rating(params.Client.Identity())
+	}
+	h.Queue = append(h.Queue, entry)
+	log.Printf("client '%s' joined the queue\n", params.Client.ID)
+	h.match(params.Preferences)
+	h.sendQueueStatus()
+}
+
+func (h *Hub) leaveQueue(client *Client) bool {
+	idx := h.queueIndex(client)
+	if idx == -1 {
+		return false
+	}
+	h.Queue = append(h.Queue[:idx], h.Queue[idx+1:]...)
+	return true
+}
+
+// match starts a game once enough clients wait with prefs, the client waiting
+// the longest plays with the clients closest to its rating.
+func (h *Hub) match(prefs QueuePreferences) {
+	candidates := []QueueEntry{}
+	for _, e := range h.Queue {
+		if e.Preferences == prefs {
+			candidates = append(candidates, e)
+		}
+	}
+	if len(candidates) < prefs.PlayerCount {
+		return
+	}
+	anchor := candidates[0]
+	others := candidates[1:]
+	slices.SortStableFunc(others, func(a, b QueueEntry) int {
+		return cmp.Compare(math.Abs(a.Rating-anchor.Rating), math.Abs(b.Rating-anchor.Rating))
+	})
+	group := append([]QueueEntry{anchor}, others[:prefs.PlayerCount-1]...)
+	for _, e := range group {
+		h.leaveQueue(e.Client)
+	}
+
+	master := group[0]
+	room := h.newRoom(master.Client, master.Name)
+	room.GameInstance.PieceCount = prefs.PieceCount
+	room.GameInstance.Rules = prefs.Rules
+	room.AutoStart = true
+	room.Matched = group
+	for _, e := range group[1:] {
+		room.GameInstance.Players = append(room.GameInstance.Players, PlayerState{Client: e.Client, Name: e.Name})
+	}
+	for idx := range room.GameInstance.Players {
+		room.GameInstance.Players[idx].IsReady = true
+	}
+	h.addRoom(room)
+	log.Printf("matched %d clients in room '%s'\n", len(group), room.ID)
+}
+
+// requeue puts the clients of a match that fell through at the front of the
+// queue, unless they left or queued again in the meantime.
+func (h *Hub) requeue(entries []QueueEntry) {
+	alive := []QueueEntry{}
+	for _, e := range entries {
+		if !e.Client.IsDone() && h.queueIndex(e.Client) == -1 {
+			alive = append(alive, e)
+		}
+	}
+	h.Queue = append(alive, h.Queue...)
+	if len(alive) != 0 {
+		h.match(alive[0].Preferences)
+	}
+	h.sendQueueStatus()
+}
+
+// handOff brings the matched clients into the room, it runs on the room's
+// loop so a slow client holds up its own match rather than the hub. A client
+// that disconnected while it was queued cannot enter, the others are given
+// back to the hub and the room closes.
+func (r *Room) handOff(hub *Hub) bool {
+	entered := []*Client{}
+	for _, e := range r.Matched {
+		if !e.Client.EnterRoom(r) {
+			break
+		}
+		entered = append(entered, e.Client)
+	}
+	if len(entered) != len(r.Matched) {
+		for _, c := range entered {
+			c.ExitRoom()
+		}
+		// the hub may be waiting on this room, which only gives up once Done
+		// is closed
+		go hub.Requeue(r.Matched)
+		return false
+	}
+
+	for _, e := range r.Matched {
+		e.Client.Send(QueueStatusResponse{Matched: true, RoomID: r.ID, PlayerCount: len(r.Matched)})
+		e.Client.Send(r.joinRoomResponse())
+	}
+	return true
+}
+
+// sendQueueStatus tells every queued client its position among the clients
+// with the same preferences.
+func (h *Hub) sendQueueStatus() {
+	waiting := map[QueuePreferences]int{}
+	for _, e := range h.Queue {
+		waiting[e.Preferences]++
+	}
+	positions := map[QueuePreferences]int{}
+	for _, e := range h.Queue {
+		positions[e.Preferences]++
+		e.Client.Send(QueueStatusResponse{
+			Queued:      true,
+			Position:    positions[e.Preferences],
+			Waiting:     waiting[e.Preferences],
+			PlayerCount: e.Preferences.PlayerCount,
+		})
+	}
+}
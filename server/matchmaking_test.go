@@ -0,0 +1,149 @@
+package main
+
+import (
+	"net"
+	"testing"
+)
+
+func joinQueue(c *testClient, playerCount int, pieceCount uint8) QueueStatusResponse {
+	c.t.Helper()
+	c.send(MessageTypeJoinQueue, map[string]any{"name": c.Name, "player_count": playerCount, "piece_count": pieceCount})
+	resp := QueueStatusResponse{}
+	c.expect(MessageTypeJoinQueue, &resp)
+	return resp
+}
+
+func TestMatchmaking(t *testing.T) {
+	hub := newTestHub(t, Config{})
+	a, b, c := connect(t, hub, "a"), connect(t, hub, "b"), connect(t, hub, "c")
+
+	status := joinQueue(a, 2, 2)
+	if !status.Queued || status.Position != 1 || status.Waiting != 1 || status.PlayerCount != 2 {
+		t.Errorf("got %+v", status)
+	}
+	// other preferences are queued on their own
+	status = joinQueue(c, 2, 4)
+	if !status.Queued || status.Position != 1 || status.Waiting != 1 {
+		t.Errorf("got %+v", status)
+	}
+
+	b.send(MessageTypeJoinQueue, map[string]any{"name": "b", "player_count": 2, "piece_count": 2})
+	room := RoomID("")
+	for _, client := range []*testClient{a, b} {
+		matched := QueueStatusResponse{}
+		for !matched.Matched {
+			client.expect(MessageTypeJoinQueue, &matched)
+		}
+		if room == "" {
+			room = matched.RoomID
+		}
+		if matched.RoomID != room {
+			t.Errorf("%s got room %s want %s", client.Name, matched.RoomID, room)
+		}
+		joined := JoinRoomResponse{}
+		client.expect(MessageTypeEnterRoom, &joined)
+		if !joined.Join || joined.RoomID != room || joined.PieceCount != 2 || len(joined.Players) != 2 {
+			t.Errorf("%s got %+v", client.Name, joined)
+		}
+		started := StartGameResponse{}
+		client.expect(MessageTypeStartGame, &started)
+		if !started.ShouldStart {
+			t.Errorf("%s: the game did not start", client.Name)
+		}
+	}
+	play(t, a, []*testClient{a, b}, is(MessageTypeEndGame))
+
+	c.send(MessageTypeLeaveQueue, nil)
+	left := LeaveQueueResponse{}
+	c.expect(MessageTypeLeaveQueue, &left)
+	if !left.Left {
+		t.Error("could not leave the queue")
+	}
+	c.send(MessageTypeLeaveQueue, nil)
+	c.expect(MessageTypeLeaveQueue, &left)
+	if left.Left {
+		t.Error("left the queue twice")
+	}
+}
+
+func TestQueuePositions(t *testing.T) {
+	hub := newTestHub(t, Config{})
+	a, b := connect(t, hub, "a"), connect(t, hub, "b")
+	joinQueue(a, 3, 4)
+	status := joinQueue(b, 3, 4)
+	if status.Position != 2 || status.Waiting != 2 {
+		t.Errorf("got %+v", status)
+	}
+	a.expect(MessageTypeJoinQueue, &status)
+	if status.Position != 1 || status.Waiting != 2 {
+		t.Errorf("got %+v", status)
+	}
+
+	// creating a room takes the client out of the queue
+	createRoom(t, a)
+	b.expect(MessageTypeJoinQueue, &status)
+	if status.Position != 1 || status.Waiting != 1 {
+		t.Errorf("got %+v", status)
+	}
+	a.send(MessageTypeJoinQueue, map[string]any{"name": "a", "player_count": 3})
+	a.expect(MessageTypeJoinQueue, &status)
+	if status.Queued {
+		t.Error("queued a client that is in a room")
+	}
+}
+
+func TestQueueDisconnect(t *testing.T) {
+	hub := newTestHub(t, Config{})
+	a, b, c := connect(t, hub, "a"), connect(t, hub, "b"), connect(t, hub, "c")
+	joinQueue(a, 3, 4)
+	joinQueue(b, 3, 4)
+	a.close()
+	// the client that left does not hold up the queue
+	status := QueueStatusResponse{}
+	for status.Waiting != 1 {
+		b.expect(MessageTypeJoinQueue, &status)
+	}
+	if status.Position != 1 {
+		t.Errorf("got %+v", status)
+	}
+	status = joinQueue(c, 3, 4)
+	if status.Matched || status.Position != 2 || status.Waiting != 2 {
+		t.Errorf("got %+v", status)
+	}
+}
+
+func TestMatchSlowClient(t *testing.T) {
+	hub := newTestHub(t, Config{})
+	a, b := connect(t, hub, "a"), connect(t, hub, "b")
+
+	// a client that stops reading holds up its own match only, its write
+	// loop is stuck on its queue status
+	server, conn := net.Pipe()
+	hub.RegisterClient(server)
+	_, err := ReadMessage(conn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	slow := &testClient{t: t, conn: conn, Name: "slow"}
+	slow.send(MessageTypeJoinQueue, map[string]any{"name": "slow", "player_count": 3, "piece_count": 2})
+	status := QueueStatusResponse{}
+	for status.Waiting != 2 {
+		status = joinQueue(a, 3, 2)
+	}
+	b.send(MessageTypeJoinQueue, map[string]any{"name": "b", "player_count": 3, "piece_count": 2})
+	c := connect(t, hub, "c")
+	c.send(MessageTypeListRooms, map[string]any{})
+	c.expect(MessageTypeListRooms, nil)
+
+	// once it is gone the others are back at the front of the queue
+	conn.Close()
+	for _, client := range []*testClient{a, b} {
+		status = QueueStatusResponse{}
+		for status.Waiting != 2 || status.Matched {
+			client.expect(MessageTypeJoinQueue, &status)
+		}
+		if !status.Queued {
+			t.Errorf("%s got %+v", client.Name, status)
+		}
+	}
+}
@@ -6,6 +6,11 @@ import (
 	"encoding/json"
 	"io"
 	"net"
+
+	"github.com/AdventurerAmer/yutnori/bot"
+	"github.com/AdventurerAmer/yutnori/fair"
+	"github.com/AdventurerAmer/yutnori/rating"
+	"github.com/AdventurerAmer/yutnori/rules"
 )
 
 type MessageType uint8
@@ -34,6 +39,39 @@ const (
 	MessageTypeEndMove
 	MessageTypeEndGame
 	MessageTypeChangeName
+	MessageTypeSetTeamCount
+	MessageTypeSetTeam
+	MessageTypeSetRuleSet
+	MessageTypeSetThrowModel
+	MessageTypeSetFairMode
+	MessageTypeContributeEntropy
+	MessageTypeRevealSeed
+	MessageTypeReconnect
+	MessageTypePlayerDisconnected
+	MessageTypePlayerReconnected
+	MessageTypeGameSnapshot
+	MessageTypeSpectatorJoined
+	MessageTypeSpectatorLeft
+	MessageTypePromoteSpectator
+	MessageTypeChat
+	MessageTypeChatHistory
+	MessageTypeListRooms
+	MessageTypeSetVisibility
+	MessageTypeSetPassword
+	MessageTypeJoinQueue
+	MessageTypeLeaveQueue
+	MessageTypeIdentify
+	MessageTypeRating
+	MessageTypeTeamFinished
+	MessageTypeSetTimeControl
+	MessageTypeTurnTimeout
+	MessageTypePlayerForfeited
+	MessageTypeAddBot
+	MessageTypeSetLeaveAction
+	MessageTypePlayerReplaced
+	MessageTypeBotMode
+	MessageTypeBotTurn
+	MessageTypeWinProbability
 )
 
 type Message struct {
@@ -52,7 +90,8 @@ func (k KeepAliveMessage) Kind() MessageType {
 }
 
 type ConnectResponse struct {
-	ClientID ClientID `json:"client_id"`
+	ClientID     ClientID `json:"client_id"`
+	SessionToken string   `json:"session_token"`
 }
 
 func (c ConnectResponse) Kind() MessageType {
@@ -60,7 +99,8 @@ func (c ConnectResponse) Kind() MessageType {
 }
 
 type CreateRoomResponse struct {
-	RoomID RoomID `json:"room_id"`
+	RoomID     RoomID `json:"room_id"`
+	InviteCode string `json:"invite_code"`
 }
 
 func (c CreateRoomResponse) Kind() MessageType {
@@ -87,17 +127,33 @@ func (c PlayerLeftResponse) Kind() MessageType {
 }
 
 type PlayerRoomStateRespone struct {
-	ClientID ClientID `json:"client_id"`
-	IsReady  bool     `json:"is_ready"`
-	Name     string   `json:"name"`
+	ClientID     ClientID       `json:"client_id"`
+	IsReady      bool           `json:"is_ready"`
+	Name         string         `json:"name"`
+	Team         int            `json:"team"`
+	Disconnected bool           `json:"disconnected"`
+	Bot          bot.Difficulty `json:"bot,omitempty"`
+	BotMode      bool           `json:"bot_mode,omitempty"`
 }
 
 type JoinRoomResponse struct {
-	RoomID     RoomID                   `json:"room_id"`
-	Join       bool                     `json:"join"`
-	Master     ClientID                 `json:"master"`
-	PieceCount uint8                    `json:"piece_count"`
-	Players    []PlayerRoomStateRespone `json:"players"`
+	RoomID      RoomID                   `json:"room_id"`
+	Join        bool                     `json:"join"`
+	Reason      string                   `json:"reason,omitempty"`
+	InviteCode  string                   `json:"invite_code"`
+	Password    bool                     `json:"password"`
+	Master      ClientID                 `json:"master"`
+	PieceCount  uint8                    `json:"piece_count"`
+	TeamCount   uint8                    `json:"team_count"`
+	Rules       rules.RuleSet            `json:"rules"`
+	ThrowModel  rules.ThrowModel         `json:"throw_model"`
+	Fair        bool                     `json:"fair"`
+	Public      bool                     `json:"public"`
+	TimeControl TimeControl              `json:"time_control"`
+	LeaveAction LeaveAction              `json:"leave_action"`
+	Players     []PlayerRoomStateRespone `json:"players"`
+	Spectator   bool                     `json:"spectator"`
+	Spectators  []SpectatorRoomState     `json:"spectators"`
 }
 
 func (j JoinRoomResponse) Kind() MessageType {
@@ -105,8 +161,11 @@ func (j JoinRoomResponse) Kind() MessageType {
 }
 
 type PlayerJoinedResponse struct {
-	ClientID ClientID `json:"client_id"`
-	Name     string   `json:"name"`
+	ClientID ClientID       `json:"client_id"`
+	Name     string         `json:"name"`
+	Team     int            `json:"team"`
+	Bot      bot.Difficulty `json:"bot,omitempty"`
+	BotMode  bool           `json:"bot_mode,omitempty"`
 }
 
 func (j PlayerJoinedResponse) Kind() MessageType {
@@ -125,6 +184,7 @@ func (p PlayerReadyResponse) Kind() MessageType {
 type StartGameResponse struct {
 	ShouldStart    bool     `json:"should_start"`
 	StartingPlayer ClientID `json:"starting_player"`
+	SeedCommitment string   `json:"seed_commitment,omitempty"`
 }
 
 func (s StartGameResponse) Kind() MessageType {
@@ -137,8 +197,19 @@ func (b BeginTurnResponse) Kind() MessageType {
 	return MessageTypeBeginTurn
 }
 
+// TimerResponse is the clock of the player asked to act, Deadline is in unix
+// milliseconds and RemainingMillis spares clients from syncing their clocks.
+type TimerResponse struct {
+	TurnSeconds     int           `json:"turn_seconds"`
+	BankMillis      int64         `json:"bank_millis"`
+	RemainingMillis int64         `json:"remaining_millis"`
+	Deadline        int64         `json:"deadline"`
+	TimeoutAction   TimeoutAction `json:"timeout_action"`
+}
+
 type CallRollResponse struct {
-	Player ClientID `json:"player"`
+	Player ClientID       `json:"player"`
+	Timer  *TimerResponse `json:"timer,omitempty"`
 }
 
 func (c CallRollResponse) Kind() MessageType {
@@ -146,8 +217,9 @@ func (c CallRollResponse) Kind() MessageType {
 }
 
 type EndRollResponse struct {
-	ShouldAppend bool `json:"should_append"`
-	Roll         int  `json:"roll"`
+	ShouldAppend bool                   `json:"should_append"`
+	Roll         int                    `json:"roll"`
+	Sticks       [rules.StickCount]bool `json:"sticks"`
 }
 
 func (e EndRollResponse) Kind() MessageType {
@@ -162,8 +234,19 @@ func (e EndTurnResponse) Kind() MessageType {
 	return MessageTypeEndTurn
 }
 
+type LegalMoveResponse struct {
+	Roll     int          `json:"roll"`
+	Cell     rules.CellID `json:"cell"`
+	Piece    int          `json:"piece"`
+	Outer    bool         `json:"outer"`
+	Path     []int        `json:"path"`
+	Finished bool         `json:"finished"`
+}
+
 type SelectingMoveResponse struct {
-	Player ClientID `json:"player"`
+	Player ClientID            `json:"player"`
+	Moves  []LegalMoveResponse `json:"moves"`
+	Timer  *TimerResponse      `json:"timer,omitempty"`
 }
 
 func (s SelectingMoveResponse) Kind() MessageType {
@@ -171,20 +254,121 @@ func (s SelectingMoveResponse) Kind() MessageType {
 }
 
 type BeginMoveRespone struct {
-	Player     ClientID `json:"player"`
-	ShouldMove bool     `json:"should_move"`
-	Roll       int      `json:"roll"`
-	Cell       CellID   `json:"cell"`
-	Piece      int      `json:"piece"`
-	Finished   bool     `json:"finished"`
+	Player     ClientID     `json:"player"`
+	ShouldMove bool         `json:"should_move"`
+	Roll       int          `json:"roll"`
+	Cell       rules.CellID `json:"cell"`
+	Piece      int          `json:"piece"`
+	Outer      bool         `json:"outer"`
+	Path       []int        `json:"path"`
+	Finished   bool         `json:"finished"`
 }
 
 func (b BeginMoveRespone) Kind() MessageType {
 	return MessageTypeBeginMove
 }
 
+type TeamFinishedResponse struct {
+	Team    int        `json:"team"`
+	Place   int        `json:"place"`
+	Players []ClientID `json:"players"`
+}
+
+func (t TeamFinishedResponse) Kind() MessageType {
+	return MessageTypeTeamFinished
+}
+
+// AddBotResponse is only sent when a bot cannot be added, an added bot is
+// announced like any player joining.
+type AddBotResponse struct {
+	ShouldAdd bool `json:"should_add"`
+}
+
+func (a AddBotResponse) Kind() MessageType {
+	return MessageTypeAddBot
+}
+
+// PlayerReplacedResponse follows the PlayerLeftResponse of a player whose
+// seat a bot took over.
+type PlayerReplacedResponse struct {
+	Player     ClientID       `json:"player"`
+	Bot        ClientID       `json:"bot"`
+	Difficulty bot.Difficulty `json:"difficulty"`
+}
+
+func (p PlayerReplacedResponse) Kind() MessageType {
+	return MessageTypePlayerReplaced
+}
+
+type BotModeResponse struct {
+	Enabled        bool  `json:"enabled"`
+	DeadlineMillis int64 `json:"deadline_millis"`
+}
+
+func (b BotModeResponse) Kind() MessageType {
+	return MessageTypeBotMode
+}
+
+// BotTurnResponse asks a client in bot mode to select one of the legal moves
+// of the snapshot.
+type BotTurnResponse struct {
+	Snapshot GameSnapshot `json:"snapshot"`
+}
+
+func (b BotTurnResponse) Kind() MessageType {
+	return MessageTypeBotTurn
+}
+
+// WinProbabilityResponse is the estimated chance of every player to win, the
+// players of a team share the chance of their team. Players is empty when no
+// game is in progress or the client is not a spectator. Position is the
+// number of game events the estimate was made at, Stale is set when the game
+// moved on since.
+type WinProbabilityResponse struct {
+	Players  []PlayerWinProbability `json:"players"`
+	Playouts int                    `json:"playouts"`
+	Position int                    `json:"position"`
+	Stale    bool                   `json:"stale"`
+}
+
+type PlayerWinProbability struct {
+	Player      ClientID `json:"player"`
+	Team        int      `json:"team"`
+	Probability float64  `json:"probability"`
+}
+
+func (w WinProbabilityResponse) Kind() MessageType {
+	return MessageTypeWinProbability
+}
+
+type TurnTimeoutResponse struct {
+	Player ClientID      `json:"player"`
+	Action TimeoutAction `json:"action"`
+}
+
+func (t TurnTimeoutResponse) Kind() MessageType {
+	return MessageTypeTurnTimeout
+}
+
+// PlayerForfeitedResponse reports a player who left the game, TeamOut is set
+// when it was the last player of its team still playing.
+type PlayerForfeitedResponse struct {
+	Player  ClientID `json:"player"`
+	Team    int      `json:"team"`
+	TeamOut bool     `json:"team_out"`
+}
+
+func (p PlayerForfeitedResponse) Kind() MessageType {
+	return MessageTypePlayerForfeited
+}
+
+// EndGameResponse ranks the teams by the order they finished, each place
+// lists the players of the team.
 type EndGameResponse struct {
-	Winner ClientID `json:"winner"`
+	Winner      ClientID     `json:"winner"`
+	WinningTeam int          `json:"winning_team"`
+	Winners     []ClientID   `json:"winners"`
+	Ranking     [][]ClientID `json:"ranking"`
 }
 
 func (b EndGameResponse) Kind() MessageType {
@@ -200,6 +384,334 @@ func (c ChangeNameResponse) Kind() MessageType {
 	return MessageTypeChangeName
 }
 
+type PlayerTeamResponse struct {
+	Player ClientID `json:"player"`
+	Team   int      `json:"team"`
+}
+
+type SetTeamCountResponse struct {
+	ShouldSet bool                 `json:"should_set"`
+	TeamCount uint8                `json:"team_count"`
+	Teams     []PlayerTeamResponse `json:"teams"`
+}
+
+func (s SetTeamCountResponse) Kind() MessageType {
+	return MessageTypeSetTeamCount
+}
+
+type SetTeamResponse struct {
+	ShouldSet bool     `json:"should_set"`
+	Player    ClientID `json:"player"`
+	Team      int      `json:"team"`
+}
+
+func (s SetTeamResponse) Kind() MessageType {
+	return MessageTypeSetTeam
+}
+
+type SetRuleSetResponse struct {
+	ShouldSet bool          `json:"should_set"`
+	Rules     rules.RuleSet `json:"rules"`
+}
+
+func (s SetRuleSetResponse) Kind() MessageType {
+	return MessageTypeSetRuleSet
+}
+
+type SetThrowModelResponse struct {
+	ShouldSet  bool             `json:"should_set"`
+	ThrowModel rules.ThrowModel `json:"throw_model"`
+}
+
+func (s SetThrowModelResponse) Kind() MessageType {
+	return MessageTypeSetThrowModel
+}
+
+type SetFairModeResponse struct {
+	ShouldSet bool `json:"should_set"`
+	Fair      bool `json:"fair"`
+}
+
+func (s SetFairModeResponse) Kind() MessageType {
+	return MessageTypeSetFairMode
+}
+
+type ContributeEntropyResponse struct {
+	Accepted bool     `json:"accepted"`
+	Player   ClientID `json:"player"`
+	Entropy  string   `json:"entropy"`
+}
+
+func (c ContributeEntropyResponse) Kind() MessageType {
+	return MessageTypeContributeEntropy
+}
+
+type RevealSeedResponse struct {
+	Log fair.Log `json:"log"`
+}
+
+func (r RevealSeedResponse) Kind() MessageType {
+	return MessageTypeRevealSeed
+}
+
+type PlayerSnapshot struct {
+	ClientID     ClientID       `json:"client_id"`
+	Name         string         `json:"name"`
+	IsReady      bool           `json:"is_ready"`
+	Team         int            `json:"team"`
+	Disconnected bool           `json:"disconnected"`
+	Bot          bot.Difficulty `json:"bot,omitempty"`
+	BotMode      bool           `json:"bot_mode,omitempty"`
+	Left         bool           `json:"left,omitempty"`
+	Pieces       []rules.Piece  `json:"pieces"`
+}
+
+// GameSnapshot is everything a client needs to draw the game from scratch,
+// CurrentMove is only set while a move is being acknowledged and LegalMoves
+// while the current player is selecting one.
+type GameSnapshot struct {
+	GameState     GameState           `json:"game_state"`
+	PieceCount    uint8               `json:"piece_count"`
+	TeamCount     uint8               `json:"team_count"`
+	Rules         rules.RuleSet       `json:"rules"`
+	PlayerTurn    ClientID            `json:"player_turn"`
+	PlayerTurnIdx int                 `json:"player_turn_idx"`
+	Rolls         []int               `json:"rolls"`
+	BonusThrows   int                 `json:"bonus_throws"`
+	LegalMoves    []LegalMoveResponse `json:"legal_moves"`
+	CurrentMove   *LegalMoveResponse  `json:"current_move,omitempty"`
+	MoveAcks      []ClientID          `json:"move_acks"`
+	WinningTeam   int                 `json:"winning_team"`
+	Ranking       []int               `json:"ranking"`
+	Timer         *TimerResponse      `json:"timer,omitempty"`
+	Players       []PlayerSnapshot    `json:"players"`
+}
+
+func (g GameSnapshot) Kind() MessageType {
+	return MessageTypeGameSnapshot
+}
+
+type ReconnectResponse struct {
+	Reconnected  bool             `json:"reconnected"`
+	ClientID     ClientID         `json:"client_id"`
+	SessionToken string           `json:"session_token"`
+	Room         JoinRoomResponse `json:"room"`
+	Snapshot     GameSnapshot     `json:"snapshot"`
+}
+
+func (r ReconnectResponse) Kind() MessageType {
+	return MessageTypeReconnect
+}
+
+type PlayerDisconnectedResponse struct {
+	Player       ClientID `json:"player"`
+	GraceSeconds int      `json:"grace_seconds"`
+}
+
+func (p PlayerDisconnectedResponse) Kind() MessageType {
+	return MessageTypePlayerDisconnected
+}
+
+type PlayerReconnectedResponse struct {
+	Player ClientID `json:"player"`
+}
+
+func (p PlayerReconnectedResponse) Kind() MessageType {
+	return MessageTypePlayerReconnected
+}
+
+type SpectatorRoomState struct {
+	ClientID ClientID `json:"client_id"`
+	Name     string   `json:"name"`
+}
+
+type SpectatorJoinedResponse struct {
+	ClientID ClientID `json:"client_id"`
+	Name     string   `json:"name"`
+}
+
+func (s SpectatorJoinedResponse) Kind() MessageType {
+	return MessageTypeSpectatorJoined
+}
+
+type SpectatorLeftResponse struct {
+	Spectator ClientID `json:"spectator"`
+	Kicked    bool     `json:"kicked"`
+}
+
+func (s SpectatorLeftResponse) Kind() MessageType {
+	return MessageTypeSpectatorLeft
+}
+
+type PromoteSpectatorResponse struct {
+	ShouldPromote bool     `json:"should_promote"`
+	Player        ClientID `json:"player"`
+	Name          string   `json:"name"`
+	Team          int      `json:"team"`
+}
+
+func (p PromoteSpectatorResponse) Kind() MessageType {
+	return MessageTypePromoteSpectator
+}
+
+type ChatResponse struct {
+	Sent   bool     `json:"sent"`
+	Reason string   `json:"reason,omitempty"`
+	From   ClientID `json:"from"`
+	Name   string   `json:"name"`
+	To     ClientID `json:"to,omitempty"`
+	Text   string   `json:"text"`
+	Time   int64    `json:"time"`
+}
+
+func (c ChatResponse) Kind() MessageType {
+	return MessageTypeChat
+}
+
+type ChatHistoryResponse struct {
+	Messages []ChatResponse `json:"messages"`
+}
+
+func (c ChatHistoryResponse) Kind() MessageType {
+	return MessageTypeChatHistory
+}
+
+type RoomListing struct {
+	RoomID         RoomID `json:"room_id"`
+	MasterName     string `json:"master_name"`
+	Password       bool   `json:"password"`
+	PlayerCount    int    `json:"player_count"`
+	MaxPlayerCount int    `json:"max_player_count"`
+	SpectatorCount int    `json:"spectator_count"`
+	BotCount       int    `json:"bot_count"`
+	PieceCount     uint8  `json:"piece_count"`
+	TeamCount      uint8  `json:"team_count"`
+	State          string `json:"state"`
+}
+
+type ListRoomsResponse struct {
+	Rooms    []RoomListing `json:"rooms"`
+	Page     int           `json:"page"`
+	PageSize int           `json:"page_size"`
+	Total    int           `json:"total"`
+}
+
+func (l ListRoomsResponse) Kind() MessageType {
+	return MessageTypeListRooms
+}
+
+type SetPasswordResponse struct {
+	ShouldSet bool `json:"should_set"`
+	Password  bool `json:"password"`
+}
+
+func (s SetPasswordResponse) Kind() MessageType {
+	return MessageTypeSetPassword
+}
+
+type SetTimeControlResponse struct {
+	ShouldSet   bool        `json:"should_set"`
+	TimeControl TimeControl `json:"time_control"`
+}
+
+func (s SetTimeControlResponse) Kind() MessageType {
+	return MessageTypeSetTimeControl
+}
+
+type SetLeaveActionResponse struct {
+	ShouldSet   bool        `json:"should_set"`
+	LeaveAction LeaveAction `json:"leave_action"`
+}
+
+func (s SetLeaveActionResponse) Kind() MessageType {
+	return MessageTypeSetLeaveAction
+}
+
+type SetVisibilityResponse struct {
+	ShouldSet bool `json:"should_set"`
+	Public    bool `json:"public"`
+}
+
+func (s SetVisibilityResponse) Kind() MessageType {
+	return MessageTypeSetVisibility
+}
+
+// QueueStatusResponse is sent whenever the queue changes, Position starts at
+// one and counts the clients with the same preferences only.
+type QueueStatusResponse struct {
+	Queued      bool   `json:"queued"`
+	Matched     bool   `json:"matched"`
+	Position    int    `json:"position"`
+	Waiting     int    `json:"waiting"`
+	PlayerCount int    `json:"player_count"`
+	RoomID      RoomID `json:"room_id"`
+}
+
+func (q QueueStatusResponse) Kind() MessageType {
+	return MessageTypeJoinQueue
+}
+
+type LeaveQueueResponse struct {
+	Left bool `json:"left"`
+}
+
+func (l LeaveQueueResponse) Kind() MessageType {
+	return MessageTypeLeaveQueue
+}
+
+// IdentifyResponse carries the token only when a new identity was created,
+// the client keeps it to identify as the same player later.
+type IdentifyResponse struct {
+	Identified bool    `json:"identified"`
+	PlayerID   string  `json:"player_id"`
+	Token      string  `json:"token,omitempty"`
+	Name       string  `json:"name"`
+	Rating     float64 `json:"rating"`
+	Games      int     `json:"games"`
+	Wins       int     `json:"wins"`
+}
+
+func (i IdentifyResponse) Kind() MessageType {
+	return MessageTypeIdentify
+}
+
+// PlayerRating has ClientID and Delta set when it is sent at the end of a game.
+type PlayerRating struct {
+	PlayerID string   `json:"player_id"`
+	ClientID ClientID `json:"client_id,omitempty"`
+	Name     string   `json:"name"`
+	Rating   float64  `json:"rating"`
+	Delta    float64  `json:"delta,omitempty"`
+	Games    int      `json:"games"`
+	Wins     int      `json:"wins"`
+}
+
+type RatingResponse struct {
+	Players []PlayerRating `json:"players"`
+}
+
+func (r RatingResponse) Kind() MessageType {
+	return MessageTypeRating
+}
+
+func playerRating(p rating.Player) PlayerRating {
+	return PlayerRating{
+		PlayerID: p.ID,
+		Name:     p.Name,
+		Rating:   p.Rating,
+		Games:    p.Games,
+		Wins:     p.Wins,
+	}
+}
+
+func pathResponse(path rules.Path) []int {
+	cells := make([]int, len(path.Cells))
+	for idx, cell := range path.Cells {
+		cells[idx] = int(cell)
+	}
+	return cells
+}
+
 func ReadMessage(conn net.Conn) (Message, error) {
 	header := make([]byte, 3)
 	for {
@@ -0,0 +1,176 @@
+package main
+
+import (
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/AdventurerAmer/yutnori/rating"
+	"github.com/AdventurerAmer/yutnori/rules"
+)
+
+func newRatings(t *testing.T) *rating.Store {
+	t.Helper()
+	store, err := rating.Open(filepath.Join(t.TempDir(), "ratings.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return store
+}
+
+func identify(c *testClient, token string) IdentifyResponse {
+	c.t.Helper()
+	c.send(MessageTypeIdentify, map[string]any{"token": token, "name": c.Name})
+	resp := IdentifyResponse{}
+	c.expect(MessageTypeIdentify, &resp)
+	return resp
+}
+
+func TestTeamPlaces(t *testing.T) {
+	s := rules.NewState(4, 4)
+	s.WinningTeam = 2
+	s.Ranking = []int{2}
+	s.Teams[0].Pieces[0] = rules.Piece{Cell: rules.BottomRightCorner, IsFinished: true}
+	s.Teams[1].Pieces[0] = rules.Piece{Cell: rules.Right1}
+	s.Teams[3].Pieces[2] = rules.Piece{Cell: rules.Top3}
+	g := &GameInstance{State: s}
+	if places := g.teamPlaces(); !slices.Equal(places, []int{1, 2, 0, 2}) {
+		t.Errorf("got places %v", places)
+	}
+	// the teams that finished come first in their finishing order
+	s.Ranking = []int{2, 1}
+	if places := g.teamPlaces(); !slices.Equal(places, []int{2, 1, 0, 3}) {
+		t.Errorf("got places %v", places)
+	}
+}
+
+func TestIdentify(t *testing.T) {
+	hub := newTestHub(t, Config{})
+	a := connect(t, hub, "a")
+	if resp := identify(a, ""); resp.Identified {
+		t.Errorf("identified without a rating store: %+v", resp)
+	}
+
+	hub = newTestHub(t, Config{Ratings: newRatings(t)})
+	a, b := connect(t, hub, "a"), connect(t, hub, "b")
+	created := identify(a, "")
+	if !created.Identified || created.Token == "" || created.Name != "a" || created.Rating != rating.DefaultRating {
+		t.Fatalf("got %+v", created)
+	}
+	again := identify(b, created.Token)
+	if !again.Identified || again.PlayerID != created.PlayerID || again.Token != "" {
+		t.Errorf("got %+v", again)
+	}
+	if resp := identify(b, "nope"); resp.Identified {
+		t.Errorf("identified with an unknown token: %+v", resp)
+	}
+	a.send(MessageTypeRating, map[string]any{})
+	ratings := RatingResponse{}
+	a.expect(MessageTypeRating, &ratings)
+	if len(ratings.Players) != 1 || ratings.Players[0].PlayerID != created.PlayerID {
+		t.Errorf("got %+v", ratings)
+	}
+	a.send(MessageTypeRating, map[string]any{"players": []string{"nobody", created.PlayerID}})
+	a.expect(MessageTypeRating, &ratings)
+	if len(ratings.Players) != 1 || ratings.Players[0].Rating != rating.DefaultRating {
+		t.Errorf("got %+v", ratings)
+	}
+
+	long := connect(t, hub, strings.Repeat("ü", MaxIdentityNameLength+1))
+	if resp := identify(long, ""); resp.Name != strings.Repeat("ü", MaxIdentityNameLength) {
+		t.Errorf("got name %q", resp.Name)
+	}
+
+	// a host creates a bounded number of identities, whichever connection
+	// it uses, the test connections all share one address
+	for range MaxIdentitiesPerHost - 2 {
+		if resp := identify(a, ""); !resp.Identified {
+			t.Fatalf("got %+v", resp)
+		}
+	}
+	for _, c := range []*testClient{a, connect(t, hub, "c")} {
+		if resp := identify(c, ""); resp.Identified {
+			t.Errorf("%s created more than %d identities: %+v", c.Name, MaxIdentitiesPerHost, resp)
+		}
+	}
+	// identifying with a token is not bounded
+	if resp := identify(b, created.Token); !resp.Identified {
+		t.Errorf("got %+v", resp)
+	}
+}
+
+func TestRecordRatings(t *testing.T) {
+	store := newRatings(t)
+	hub := newTestHub(t, Config{Ratings: store})
+	a, b, c := connect(t, hub, "a"), connect(t, hub, "b"), connect(t, hub, "c")
+	identities := map[ClientID]string{}
+	for _, client := range []*testClient{a, b} {
+		identities[client.ID] = identify(client, "").PlayerID
+	}
+	newRoom(t, a, b, c)
+	startGame(t, a, b, c)
+	end := EndGameResponse{}
+	decode(t, play(t, a, []*testClient{a, b, c}, is(MessageTypeEndGame)), &end)
+
+	// the player who did not identify is not rated
+	ratings := RatingResponse{}
+	a.expect(MessageTypeRating, &ratings)
+	if len(ratings.Players) != 2 {
+		t.Fatalf("got %+v", ratings)
+	}
+	for _, p := range ratings.Players {
+		if identities[p.ClientID] != p.PlayerID || p.Games != 1 || p.Rating != rating.DefaultRating+p.Delta {
+			t.Errorf("got %+v", p)
+		}
+		if won := p.ClientID == end.Winner; won && p.Delta <= 0 || won != (p.Wins == 1) {
+			t.Errorf("winner %s got %+v", end.Winner, p)
+		}
+		if store.Rating(p.PlayerID) != p.Rating {
+			t.Errorf("stored %f want %f", store.Rating(p.PlayerID), p.Rating)
+		}
+	}
+}
+
+func TestRecordRatingsLeaver(t *testing.T) {
+	store := newRatings(t)
+	hub := newTestHub(t, Config{Ratings: store})
+	a, b, c := connect(t, hub, "a"), connect(t, hub, "b"), connect(t, hub, "c")
+	identify(a, "")
+	leaver := identify(c, "").PlayerID
+	newRoom(t, a, b, c)
+	setLeaveAction(a, LeaveForfeit)
+	startGame(t, a, b, c)
+	c.send(MessageTypeExitRoom, nil)
+	play(t, a, []*testClient{a, b}, is(MessageTypeEndGame))
+
+	// leaving does not spare the loss
+	a.expect(MessageTypeRating, nil)
+	if got := store.Rating(leaver); got >= rating.DefaultRating {
+		t.Errorf("the leaver kept a rating of %f", got)
+	}
+}
+
+func TestRecordRatingsReset(t *testing.T) {
+	store := newRatings(t)
+	hub := newTestHub(t, Config{Ratings: store})
+	a, b := connect(t, hub, "a"), connect(t, hub, "b")
+	stayed, leaver := identify(a, "").PlayerID, identify(b, "").PlayerID
+	newRoom(t, a, b)
+	startGame(t, a, b)
+	b.send(MessageTypeExitRoom, nil)
+
+	// the leaver takes the last place in the abandoned game
+	ratings := RatingResponse{}
+	a.expect(MessageTypeRating, &ratings)
+	if len(ratings.Players) != 2 {
+		t.Fatalf("got %+v", ratings)
+	}
+	if got := store.Rating(leaver); got >= rating.DefaultRating {
+		t.Errorf("the leaver kept a rating of %f", got)
+	}
+	if got := store.Rating(stayed); got <= rating.DefaultRating {
+		t.Errorf("the player who stayed got a rating of %f", got)
+	}
+	a.expect(MessageTypePlayerLeft, nil)
+}
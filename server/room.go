@@ -1,18 +1,27 @@
 package main
 
 import (
+	"crypto/subtle"
 	"log"
-	"math/rand"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/AdventurerAmer/yutnori/rating"
+	"github.com/AdventurerAmer/yutnori/rules"
 )
 
 type RoomID string
 
-const MaxPlayerCountInRoom = 6
-const MinPlayerCountToStartGame = 2
+const MaxPlayerCountInRoom = rules.MaxPlayerCount
+const MinPlayerCountToStartGame = rules.MinPlayerCount
+const MaxSpectatorCountInRoom = 32
+const MaxRoomPasswordLength = 64
 
 type ExitRoomParams struct {
 	Client ClientID
 	Kicked bool
+	By     *Client // the client who kicked, only the master may
 }
 
 type PlayerReadyParams struct {
@@ -24,94 +33,353 @@ type StartGameParams struct {
 	Client *Client
 }
 
+type ReconnectParams struct {
+	Client  *Client
+	Session *Client
+	Done    chan bool
+}
+
 type GameExecutor interface {
 	Execute(*Client, *Room)
 }
 
+// SpectatorExecutor is implemented by the game actions spectators may execute
+// as well, every other action is reserved to the players.
+type SpectatorExecutor interface {
+	GameExecutor
+	SpectatorAllowed() bool
+}
+
+type SpectatorState struct {
+	Client *Client
+	Name   string
+}
+
 type GameActionParams struct {
 	Client   *Client
 	Executor GameExecutor
 }
 
+// RoomInfo is what the room listing shows about a room, the room refreshes it
+// from its own loop and the hub reads it from its loop.
+type RoomInfo struct {
+	ID             RoomID
+	Public         bool
+	Password       bool
+	MasterName     string
+	PlayerCount    int
+	SpectatorCount int
+	BotCount       int
+	PieceCount     uint8
+	TeamCount      uint8
+	InGame         bool
+	CreatedAt      time.Time
+}
+
 type Room struct {
-	ID           RoomID
-	Master       *Client
-	GameInstance *GameInstance
+	ID             RoomID
+	InviteCode     string
+	Password       string
+	Public         bool
+	CreatedAt      time.Time
+	Master         *Client
+	GameInstance   *GameInstance
+	Spectators     []SpectatorState
+	ChatFilter     *ChatFilter
+	Ratings        *rating.Store
+	ChatHistory    []ChatResponse
+	AutoStart      bool         // set by matchmaking, the game starts once the room runs
+	Matched        []QueueEntry // set by matchmaking, handed the room once it runs
+	LeaveAction    LeaveAction
+	ReplayDir      string
+	ReconnectGrace time.Duration
+	BotDeadline    time.Duration
 
-	EnterRoomCh   chan EnterRoomParams
-	ExitRoomCh    chan ExitRoomParams
-	PlayerReadyCh chan PlayerReadyParams
-	StartGameCh   chan *Client
+	EnterRoomCh     chan EnterRoomParams
+	ExitRoomCh      chan ExitRoomParams
+	PlayerReadyCh   chan PlayerReadyParams
+	StartGameCh     chan *Client
+	DisconnectCh    chan *Client
+	ReconnectCh     chan ReconnectParams
+	ExpireSessionCh chan *Client
+	TurnTimeoutCh   chan uint64
+	EstimateCh      chan WinEstimate
 
 	GameActionCh chan GameActionParams
+
+	Done chan struct{} // closed once the room's read loop returns
+
+	infoMu sync.Mutex
+	info   RoomInfo
 }
 
 func NewRoom(master *Client, masterName string) *Room {
 	r := &Room{
 		ID:           RoomID(generateUUID()),
+		CreatedAt:    time.Now(),
+		LeaveAction:  LeaveReset,
 		Master:       master,
 		GameInstance: NewGameInstance(),
 
-		EnterRoomCh:   make(chan EnterRoomParams),
-		ExitRoomCh:    make(chan ExitRoomParams),
-		PlayerReadyCh: make(chan PlayerReadyParams),
-		StartGameCh:   make(chan *Client),
+		EnterRoomCh:     make(chan EnterRoomParams),
+		ExitRoomCh:      make(chan ExitRoomParams),
+		PlayerReadyCh:   make(chan PlayerReadyParams),
+		StartGameCh:     make(chan *Client),
+		DisconnectCh:    make(chan *Client),
+		ReconnectCh:     make(chan ReconnectParams),
+		ExpireSessionCh: make(chan *Client),
+		TurnTimeoutCh:   make(chan uint64),
+		EstimateCh:      make(chan WinEstimate),
 
 		GameActionCh: make(chan GameActionParams),
+
+		Done: make(chan struct{}),
 	}
 	r.GameInstance.Players = append(r.GameInstance.Players, PlayerState{Client: master, Name: masterName})
+	r.updateInfo()
 	return r
 }
 
-func (r *Room) Enter(client *Client, clientName string) {
+func (r *Room) Enter(client *Client, clientName string, password string, spectate bool) {
 	if r == nil {
 		return
 	}
-	r.EnterRoomCh <- EnterRoomParams{Client: client, ClientName: clientName}
+	select {
+	case r.EnterRoomCh <- EnterRoomParams{Client: client, ClientName: clientName, Password: password, Spectate: spectate}:
+	case <-r.Done:
+	}
 }
 
-func (r *Room) Exit(client ClientID, kicked bool) {
+func (r *Room) Exit(client ClientID) {
 	if r == nil {
 		return
 	}
-	r.ExitRoomCh <- ExitRoomParams{Client: client, Kicked: kicked}
+	select {
+	case r.ExitRoomCh <- ExitRoomParams{Client: client}:
+	case <-r.Done:
+	}
+}
+
+func (r *Room) Kick(by *Client, client ClientID) {
+	if r == nil {
+		return
+	}
+	select {
+	case r.ExitRoomCh <- ExitRoomParams{Client: client, Kicked: true, By: by}:
+	case <-r.Done:
+	}
+}
+
+// Disconnect is called when the client's connection drops, during a game its
+// seat is held for the reconnect grace period.
+func (r *Room) Disconnect(client *Client) {
+	if r == nil {
+		return
+	}
+	select {
+	case r.DisconnectCh <- client:
+	case <-r.Done:
+	}
+}
+
+// Reconnect binds client to the seat held for session and reports whether it
+// succeeded.
+func (r *Room) Reconnect(client *Client, session *Client) bool {
+	if r == nil {
+		return false
+	}
+	done := make(chan bool, 1)
+	select {
+	case r.ReconnectCh <- ReconnectParams{Client: client, Session: session, Done: done}:
+	case <-r.Done:
+		return false
+	}
+	return <-done
+}
+
+func (r *Room) ExpireSession(client *Client) {
+	if r == nil {
+		return
+	}
+	select {
+	case r.ExpireSessionCh <- client:
+	case <-r.Done:
+	}
+}
+
+// TurnTimeout is called by the turn timer started with seq.
+func (r *Room) TurnTimeout(seq uint64) {
+	select {
+	case r.TurnTimeoutCh <- seq:
+	case <-r.Done:
+	}
+}
+
+// EstimateDone is called by the goroutine computing a win estimate.
+func (r *Room) EstimateDone(e WinEstimate) {
+	select {
+	case r.EstimateCh <- e:
+	case <-r.Done:
+	}
 }
 
 func (r *Room) ReadyPlayer(client *Client, isReady bool) {
 	if r == nil {
 		return
 	}
-	r.PlayerReadyCh <- PlayerReadyParams{Client: client, IsReady: isReady}
+	select {
+	case r.PlayerReadyCh <- PlayerReadyParams{Client: client, IsReady: isReady}:
+	case <-r.Done:
+	}
 }
 
 func (r *Room) StartGame(client *Client) {
 	if r == nil {
 		return
 	}
-	r.StartGameCh <- client
+	select {
+	case r.StartGameCh <- client:
+	case <-r.Done:
+	}
 }
 
 func (r *Room) ExecuteGameAction(c *Client, e GameExecutor) {
 	if r == nil {
 		return
 	}
-	r.GameActionCh <- GameActionParams{Client: c, Executor: e}
+	select {
+	case r.GameActionCh <- GameActionParams{Client: c, Executor: e}:
+	case <-r.Done:
+	}
+}
+
+func (r *Room) GetSpectatorIndex(client ClientID) int {
+	for idx, s := range r.Spectators {
+		if s.Client.ID == client {
+			return idx
+		}
+	}
+	return -1
+}
+
+func (r *Room) IsSpectator(c *Client) bool {
+	idx := r.GetSpectatorIndex(c.ID)
+	return idx != -1 && r.Spectators[idx].Client == c
+}
+
+// FindMember looks a connected player or a spectator up by ID.
+func (r *Room) FindMember(id ClientID) (*Client, string) {
+	for _, p := range r.GameInstance.Players {
+		if p.Client.ID == id && !p.Disconnected {
+			return p.Client, p.Name
+		}
+	}
+	if idx := r.GetSpectatorIndex(id); idx != -1 {
+		return r.Spectators[idx].Client, r.Spectators[idx].Name
+	}
+	return nil, ""
+}
+
+func (r *Room) CheckPassword(password string) bool {
+	return subtle.ConstantTimeCompare([]byte(r.Password), []byte(password)) == 1
+}
+
+func (r *Room) Info() RoomInfo {
+	r.infoMu.Lock()
+	defer r.infoMu.Unlock()
+	return r.info
+}
+
+func (r *Room) updateInfo() {
+	info := RoomInfo{
+		ID:             r.ID,
+		Public:         r.Public,
+		Password:       r.Password != "",
+		PlayerCount:    len(r.GameInstance.Players),
+		SpectatorCount: len(r.Spectators),
+		PieceCount:     r.GameInstance.PieceCount,
+		TeamCount:      r.GameInstance.TeamCount,
+		InGame:         r.GameInstance.GameState != GameStateGameEnded,
+		CreatedAt:      r.CreatedAt,
+	}
+	for _, p := range r.GameInstance.Players {
+		if p.Client == r.Master {
+			info.MasterName = p.Name
+		}
+		if p.Bot != "" || p.Client.BotMode() {
+			info.BotCount++
+		}
+	}
+	r.infoMu.Lock()
+	defer r.infoMu.Unlock()
+	r.info = info
+}
+
+func (r *Room) chatHistoryResponse() ChatHistoryResponse {
+	return ChatHistoryResponse{Messages: append([]ChatResponse{}, r.ChatHistory...)}
 }
 
 func (r *Room) ReadLoop(hub *Hub) {
 	defer hub.DestroyRoom(r)
+	defer closeSpectators(r)
+	defer close(r.Done)
+	if r.AutoStart {
+		if !r.handOff(hub) {
+			return
+		}
+		r.GameInstance.Start(r)
+		r.updateInfo()
+	}
 	for {
 		select {
 		case params := <-r.EnterRoomCh:
-			enter(r, params.Client, params.ClientName)
+			if !r.CheckPassword(params.Password) {
+				params.Client.Send(JoinRoomResponse{Reason: "wrong password"})
+			} else if params.Spectate {
+				spectate(r, params.Client, params.ClientName)
+			} else {
+				enter(r, params.Client, params.ClientName)
+			}
 		case msg := <-r.ExitRoomCh:
-			err := exit(r, msg.Client, msg.Kicked)
+			if msg.Kicked && msg.By != r.Master {
+				log.Printf("client '%s' cannot kick because he is not the master\n", msg.By.ID)
+				break
+			}
+			err := exit(r, msg.Client, msg.Kicked, r.LeaveAction)
 			if err != nil {
 				log.Println(err)
 			}
 			if len(r.GameInstance.Players) == 0 {
 				return
 			}
+		case client := <-r.DisconnectCh:
+			disconnect(r, hub, client)
+			if len(r.GameInstance.Players) == 0 {
+				return
+			}
+		case params := <-r.ReconnectCh:
+			params.Done <- reconnect(r, hub, params.Client, params.Session)
+		case client := <-r.ExpireSessionCh:
+			idx := r.GameInstance.GetClientIndex(client)
+			if idx == -1 || !r.GameInstance.Players[idx].Disconnected {
+				break
+			}
+			log.Printf("client '%s' did not reconnect in time\n", client.ID)
+			err := exit(r, client.ID, false, r.LeaveAction)
+			if err != nil {
+				log.Println(err)
+			}
+			hub.EndSession(client.SessionToken)
+			if len(r.GameInstance.Players) == 0 {
+				return
+			}
+		case seq := <-r.TurnTimeoutCh:
+			r.GameInstance.TurnTimeout(r, seq)
+			if len(r.GameInstance.Players) == 0 {
+				return
+			}
+		case e := <-r.EstimateCh:
+			r.GameInstance.finishEstimate(r, e)
 		case msg := <-r.PlayerReadyCh:
 			idx := r.GameInstance.GetClientIndex(msg.Client)
 			if idx == -1 {
@@ -130,12 +398,14 @@ func (r *Room) ReadLoop(hub *Hub) {
 			}
 			r.GameInstance.Start(r)
 		case action := <-r.GameActionCh:
-			if !r.GameInstance.IsClientInRoom(action.Client) {
+			_, spectatorAllowed := action.Executor.(SpectatorExecutor)
+			if !r.GameInstance.IsClientInRoom(action.Client) && !(spectatorAllowed && r.IsSpectator(action.Client)) {
 				log.Printf("client '%s' cannot execute action because he is not in the room\n", action.Client.ID)
 				break
 			}
 			action.Executor.Execute(action.Client, r)
 		}
+		r.updateInfo()
 	}
 }
 
@@ -145,38 +415,193 @@ func (r *Room) Broadcast(serializer MessageSerializer) error {
 		return err
 	}
 	for _, p := range r.GameInstance.Players {
+		if p.Disconnected {
+			continue
+		}
 		p.Client.SendBytes(msg)
 	}
+	for _, s := range r.Spectators {
+		s.Client.SendBytes(msg)
+	}
 	return nil
 }
 
-func enter(r *Room, client *Client, clientName string) {
-	if len(r.GameInstance.Players) == MaxPlayerCountInRoom {
-		client.Send(JoinRoomResponse{})
-		return
-	}
+func (r *Room) joinRoomResponse() JoinRoomResponse {
 	players := []PlayerRoomStateRespone{}
 	for _, p := range r.GameInstance.Players {
 		state := PlayerRoomStateRespone{
-			ClientID: p.Client.ID,
-			IsReady:  p.IsReady,
-			Name:     p.Name,
+			ClientID:     p.Client.ID,
+			IsReady:      p.IsReady,
+			Name:         p.Name,
+			Team:         p.Team,
+			Disconnected: p.Disconnected,
+			Bot:          p.Bot,
+			BotMode:      p.Client.BotMode(),
 		}
 		players = append(players, state)
 	}
-	client.Send(JoinRoomResponse{
-		RoomID:     r.ID,
-		Join:       true,
-		Master:     r.Master.ID,
-		PieceCount: r.GameInstance.PieceCount,
-		Players:    players,
+	spectators := []SpectatorRoomState{}
+	for _, s := range r.Spectators {
+		spectators = append(spectators, SpectatorRoomState{ClientID: s.Client.ID, Name: s.Name})
+	}
+	return JoinRoomResponse{
+		RoomID:      r.ID,
+		Join:        true,
+		InviteCode:  r.InviteCode,
+		Password:    r.Password != "",
+		Master:      r.Master.ID,
+		PieceCount:  r.GameInstance.PieceCount,
+		TeamCount:   r.GameInstance.TeamCount,
+		Rules:       r.GameInstance.Rules,
+		ThrowModel:  r.GameInstance.ThrowModel,
+		Fair:        r.GameInstance.Fair,
+		Public:      r.Public,
+		TimeControl: r.GameInstance.TimeControl,
+		LeaveAction: r.LeaveAction,
+		Players:     players,
+		Spectators:  spectators,
+	}
+}
+
+func enter(r *Room, client *Client, clientName string) {
+	if len(r.GameInstance.Players) == MaxPlayerCountInRoom {
+		client.Send(JoinRoomResponse{Reason: "room is full"})
+		return
+	}
+	if r.GameInstance.GameState != GameStateGameEnded {
+		client.Send(JoinRoomResponse{Reason: "game in progress"})
+		return
+	}
+	client.Send(r.joinRoomResponse())
+	client.Send(r.chatHistoryResponse())
+	team := r.GameInstance.SmallestTeam()
+	r.Broadcast(PlayerJoinedResponse{ClientID: client.ID, Name: clientName, Team: team, BotMode: client.BotMode()})
+	r.GameInstance.Players = append(r.GameInstance.Players, PlayerState{Client: client, Name: clientName, Team: team})
+	client.EnterRoom(r)
+}
+
+// spectate lets a client watch the room, it is allowed while a game is in
+// progress and the spectator gets the game snapshot right after joining.
+func spectate(r *Room, client *Client, clientName string) {
+	if len(r.Spectators) == MaxSpectatorCountInRoom {
+		client.Send(JoinRoomResponse{Reason: "room is full"})
+		return
+	}
+	response := r.joinRoomResponse()
+	response.Spectator = true
+	client.Send(response)
+	client.Send(r.GameInstance.Snapshot())
+	client.Send(r.chatHistoryResponse())
+	r.Broadcast(SpectatorJoinedResponse{ClientID: client.ID, Name: clientName})
+	r.Spectators = append(r.Spectators, SpectatorState{Client: client, Name: clientName})
+	client.EnterRoom(r)
+}
+
+func exitSpectator(r *Room, idx int, kicked bool) error {
+	spectator := r.Spectators[idx]
+	spectator.Client.ExitRoom()
+	err := r.Broadcast(SpectatorLeftResponse{Spectator: spectator.Client.ID, Kicked: kicked})
+	r.Spectators = slices.Delete(r.Spectators, idx, idx+1)
+	return err
+}
+
+// closeSpectators sends the spectators out of a room that has no players left.
+func closeSpectators(r *Room) {
+	for _, s := range r.Spectators {
+		s.Client.Send(SpectatorLeftResponse{Spectator: s.Client.ID})
+		s.Client.ExitRoom()
+	}
+	r.Spectators = nil
+}
+
+func disconnect(r *Room, hub *Hub, client *Client) {
+	idx := r.GameInstance.GetClientIndex(client)
+	if idx == -1 {
+		if r.IsSpectator(client) {
+			err := exitSpectator(r, r.GetSpectatorIndex(client.ID), false)
+			if err != nil {
+				log.Println(err)
+			}
+			hub.EndSession(client.SessionToken)
+		}
+		return
+	}
+	player := &r.GameInstance.Players[idx]
+	if player.Disconnected {
+		return
+	}
+	if r.GameInstance.GameState == GameStateGameEnded || r.ReconnectGrace <= 0 {
+		err := exit(r, client.ID, false, r.LeaveAction)
+		if err != nil {
+			log.Println(err)
+		}
+		hub.EndSession(client.SessionToken)
+		return
+	}
+
+	player.Disconnected = true
+	if r.GameInstance.Replay != nil {
+		r.GameInstance.Replay.RecordConnectionLost(idx)
+	}
+	player.GraceTimer = time.AfterFunc(r.ReconnectGrace, func() {
+		r.ExpireSession(client)
 	})
-	r.Broadcast(PlayerJoinedResponse{ClientID: client.ID, Name: clientName})
-	r.GameInstance.Players = append(r.GameInstance.Players, PlayerState{Client: client, Name: clientName})
+	err := r.Broadcast(PlayerDisconnectedResponse{
+		Player:       client.ID,
+		GraceSeconds: int(r.ReconnectGrace.Seconds()),
+	})
+	if err != nil {
+		log.Println(err)
+	}
+	r.GameInstance.TryEndMove(r)
+}
+
+func reconnect(r *Room, hub *Hub, client *Client, session *Client) bool {
+	idx := r.GameInstance.GetClientIndex(session)
+	if idx == -1 || !r.GameInstance.Players[idx].Disconnected {
+		return false
+	}
+	player := &r.GameInstance.Players[idx]
+	player.GraceTimer.Stop()
+
+	// the reconnecting client takes over the identity of the one it replaces,
+	// whose write loop would otherwise live on until its next keep-alive
+	session.Replace()
+	hub.TakeOverSession(client, session)
+	player.Client = client
+	player.Disconnected = false
+	if r.GameInstance.Replay != nil {
+		r.GameInstance.Replay.RecordReconnect(idx)
+	}
+	if r.Master == session {
+		r.Master = client
+	}
+	r.GameInstance.ReplaceClient(session, client)
+
+	// the room is set before the response goes out, a client closing right
+	// after reconnecting still disconnects from its seat
 	client.EnterRoom(r)
+	client.Send(ReconnectResponse{
+		Reconnected:  true,
+		ClientID:     client.ID,
+		SessionToken: client.SessionToken,
+		Room:         r.joinRoomResponse(),
+		Snapshot:     r.GameInstance.Snapshot(),
+	})
+	client.Send(r.chatHistoryResponse())
+	err := r.Broadcast(PlayerReconnectedResponse{Player: client.ID})
+	if err != nil {
+		log.Println(err)
+	}
+	log.Printf("client '%s' reconnected to room '%s'\n", client.ID, r.ID)
+	return true
 }
 
-func exit(r *Room, clientID ClientID, kicked bool) error {
+func exit(r *Room, clientID ClientID, kicked bool, action LeaveAction) error {
+	if idx := r.GetSpectatorIndex(clientID); idx != -1 {
+		return exitSpectator(r, idx, kicked)
+	}
+
 	clientCount := len(r.GameInstance.Players)
 	if clientCount == 0 {
 		return nil
@@ -187,9 +612,22 @@ func exit(r *Room, clientID ClientID, kicked bool) error {
 	for idx, p := range r.GameInstance.Players {
 		if p.Client.ID == clientID {
 			isInRoom = true
-			if kicked {
+			if r.GameInstance.Replay != nil {
+				r.GameInstance.Replay.RecordDisconnect(idx)
+			}
+			if p.Disconnected {
+				p.GraceTimer.Stop()
+			} else {
 				p.Client.ExitRoom()
 			}
+			if r.canKeepPlaying(idx, action) {
+				return leaveGame(r, idx, kicked, action)
+			}
+			if r.GameInstance.GameState != GameStateGameEnded {
+				// the game is abandoned, which does not spare the leaver a loss
+				r.GameInstance.Players[idx].Leaver = p.Client.Identity()
+				r.GameInstance.RecordRatings(r)
+			}
 			r.GameInstance.Players[idx], r.GameInstance.Players[clientCount-1] = r.GameInstance.Players[clientCount-1], r.GameInstance.Players[idx]
 			break
 		}
@@ -201,8 +639,15 @@ func exit(r *Room, clientID ClientID, kicked bool) error {
 
 	masterID := ClientID("")
 
-	if clientCount-1 > 0 {
-		masterIdx := rand.Int31n(int32(clientCount) - 1)
+	// bots cannot be masters, a room left with bots only is closed
+	humans := []int{}
+	for idx, p := range r.GameInstance.Players[:clientCount-1] {
+		if !p.Client.Bot {
+			humans = append(humans, idx)
+		}
+	}
+	if len(humans) > 0 {
+		masterIdx := humans[r.GameInstance.BotRand.Intn(len(humans))]
 		r.Master = r.GameInstance.Players[masterIdx].Client
 		masterID = r.Master.ID
 	}
@@ -214,7 +659,12 @@ func exit(r *Room, clientID ClientID, kicked bool) error {
 
 	r.GameInstance.Players = r.GameInstance.Players[:clientCount-1]
 	if r.GameInstance.GameState != GameStateGameEnded {
+		r.GameInstance.RevealSeed(r)
+		r.GameInstance.SaveReplay(r)
 		r.GameInstance.Reset()
 	}
+	if len(humans) == 0 {
+		r.GameInstance.Players = nil
+	}
 	return nil
 }
@@ -0,0 +1,409 @@
+package main
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestReconnect(t *testing.T) {
+	hub := newTestHub(t, Config{ReconnectGrace: time.Minute})
+	a, b := connect(t, hub, "a"), connect(t, hub, "b")
+	newRoom(t, a, b)
+	startGame(t, a, b)
+
+	b.close()
+	resp := PlayerDisconnectedResponse{}
+	a.expect(MessageTypePlayerDisconnected, &resp)
+	if resp.Player != b.ID || resp.GraceSeconds != 60 {
+		t.Errorf("got %+v", resp)
+	}
+
+	again := connect(t, hub, "b")
+	again.send(MessageTypeReconnect, map[string]any{"session_token": b.Token})
+	reconnected := ReconnectResponse{}
+	again.expect(MessageTypeReconnect, &reconnected)
+	if !reconnected.Reconnected || reconnected.ClientID != b.ID || reconnected.SessionToken != b.Token {
+		t.Fatalf("got %+v", reconnected)
+	}
+	if reconnected.Room.Master != a.ID || len(reconnected.Snapshot.Players) != 2 {
+		t.Errorf("got room %+v snapshot %+v", reconnected.Room, reconnected.Snapshot)
+	}
+	back := PlayerReconnectedResponse{}
+	a.expect(MessageTypePlayerReconnected, &back)
+	if back.Player != b.ID {
+		t.Errorf("got %+v", back)
+	}
+
+	// the reconnected client plays on in the seat it got back, the game is
+	// still waiting for the first roll
+	again.ID = b.ID
+	again.waitRoom()
+	if reconnected.Snapshot.GameState != GameStateCanRoll {
+		t.Fatalf("got game state %d", reconnected.Snapshot.GameState)
+	}
+	for _, c := range []*testClient{a, again} {
+		if c.ID == reconnected.Snapshot.PlayerTurn {
+			c.send(MessageTypeBeginRoll, nil)
+		}
+	}
+	end := EndGameResponse{}
+	msg := play(t, a, []*testClient{a, again}, is(MessageTypeEndGame))
+	decode(t, msg, &end)
+	if end.Winner != a.ID && end.Winner != b.ID {
+		t.Errorf("got winner %s", end.Winner)
+	}
+}
+
+func TestReconnectReplacesClient(t *testing.T) {
+	hub := newTestHub(t, Config{ReconnectGrace: time.Minute})
+	a, b := connect(t, hub, "a"), connect(t, hub, "b")
+	newRoom(t, a, b)
+	startGame(t, a, b)
+
+	// every connection in turn takes the seat over from the one before
+	seat := b
+	for range 2 {
+		seat.close()
+		a.expect(MessageTypePlayerDisconnected, nil)
+		again := connect(t, hub, "b")
+		again.send(MessageTypeReconnect, map[string]any{"session_token": b.Token})
+		reconnected := ReconnectResponse{}
+		again.expect(MessageTypeReconnect, &reconnected)
+		if !reconnected.Reconnected {
+			t.Fatal("could not reconnect")
+		}
+		select {
+		case <-seat.client.Done:
+		case <-time.After(testTimeout):
+			t.Fatal("the write loop of the replaced client is still running")
+		}
+		if session := hub.FindSession(b.Token); session != again.client || session.ID != b.ID {
+			t.Errorf("the session belongs to %+v", session)
+		}
+		seat = again
+	}
+}
+
+func TestReconnectRejected(t *testing.T) {
+	hub := newTestHub(t, Config{ReconnectGrace: time.Minute})
+	a, b := connect(t, hub, "a"), connect(t, hub, "b")
+	newRoom(t, a, b)
+
+	tests := []struct {
+		name  string
+		token string
+	}{
+		{"unknown token", "token"},
+		{"connected player", b.Token},
+	}
+	for _, test := range tests {
+		c := connect(t, hub, "c")
+		c.send(MessageTypeReconnect, map[string]any{"session_token": test.token})
+		resp := ReconnectResponse{}
+		c.expect(MessageTypeReconnect, &resp)
+		if resp.Reconnected {
+			t.Errorf("%s: reconnected", test.name)
+		}
+	}
+}
+
+func TestReconnectGraceExpires(t *testing.T) {
+	hub := newTestHub(t, Config{ReconnectGrace: 50 * time.Millisecond})
+	a, b := connect(t, hub, "a"), connect(t, hub, "b")
+	newRoom(t, a, b)
+	startGame(t, a, b)
+
+	b.close()
+	left := PlayerLeftResponse{}
+	a.expect(MessageTypePlayerLeft, &left)
+	if left.Player != b.ID || left.Kicked {
+		t.Errorf("got %+v", left)
+	}
+
+	again := connect(t, hub, "b")
+	again.send(MessageTypeReconnect, map[string]any{"session_token": b.Token})
+	resp := ReconnectResponse{}
+	again.expect(MessageTypeReconnect, &resp)
+	if resp.Reconnected {
+		t.Error("reconnected after the grace period")
+	}
+}
+
+func TestGameSnapshot(t *testing.T) {
+	hub := newTestHub(t, Config{})
+	a, b := connect(t, hub, "a"), connect(t, hub, "b")
+
+	a.send(MessageTypeGameSnapshot, nil)
+	snapshot := GameSnapshot{}
+	a.expect(MessageTypeGameSnapshot, &snapshot)
+	if snapshot.GameState != GameStateGameEnded || len(snapshot.Players) != 0 {
+		t.Errorf("outside a room got %+v", snapshot)
+	}
+
+	newRoom(t, a, b)
+	b.send(MessageTypePlayerReady, map[string]any{"is_ready": true})
+	b.sync()
+	a.send(MessageTypeGameSnapshot, nil)
+	a.expect(MessageTypeGameSnapshot, &snapshot)
+	if len(snapshot.Players) != 2 || snapshot.Players[1].Name != "b" || !snapshot.Players[1].IsReady || snapshot.Players[0].IsReady {
+		t.Errorf("in the lobby got players %+v", snapshot.Players)
+	}
+
+	startGame(t, a, b)
+	clients := []*testClient{a, b}
+	msg := play(t, a, clients, is(MessageTypeSelectingMove))
+	selecting := SelectingMoveResponse{}
+	decode(t, msg, &selecting)
+	b.send(MessageTypeGameSnapshot, nil)
+	snapshot = GameSnapshot{}
+	b.expect(MessageTypeGameSnapshot, &snapshot)
+	if snapshot.GameState != GameStateSelectingMove || snapshot.PlayerTurn != selecting.Player || len(snapshot.Rolls) == 0 {
+		t.Errorf("selecting a move got %+v", snapshot)
+	}
+	if !reflect.DeepEqual(snapshot.LegalMoves, selecting.Moves) {
+		t.Errorf("got legal moves %+v want %+v", snapshot.LegalMoves, selecting.Moves)
+	}
+	if len(snapshot.Players) != 2 || len(snapshot.Players[0].Pieces) != int(snapshot.PieceCount) {
+		t.Errorf("got players %+v", snapshot.Players)
+	}
+
+	mover := a
+	if selecting.Player == b.ID {
+		mover = b
+	}
+	mover.send(MessageTypeBeginMove, selecting.Moves[0])
+	moving := BeginMoveRespone{}
+	a.expect(MessageTypeBeginMove, &moving)
+	a.send(MessageTypeEndMove, moving)
+	a.sync()
+	b.send(MessageTypeGameSnapshot, nil)
+	snapshot = GameSnapshot{}
+	b.expect(MessageTypeGameSnapshot, &snapshot)
+	if snapshot.GameState != GameStateBeginMove || snapshot.CurrentMove == nil || !reflect.DeepEqual(*snapshot.CurrentMove, selecting.Moves[0]) {
+		t.Errorf("moving got %+v", snapshot)
+	}
+	if !reflect.DeepEqual(snapshot.MoveAcks, []ClientID{a.ID}) {
+		t.Errorf("got acknowledgements %v", snapshot.MoveAcks)
+	}
+}
+
+func spectateRoom(t *testing.T, c *testClient, room RoomID) JoinRoomResponse {
+	t.Helper()
+	c.send(MessageTypeEnterRoom, map[string]any{"room_id": room, "name": c.Name, "spectate": true})
+	resp := JoinRoomResponse{}
+	c.expect(MessageTypeEnterRoom, &resp)
+	if resp.Join {
+		c.waitRoom()
+	}
+	return resp
+}
+
+func TestSpectate(t *testing.T) {
+	hub := newTestHub(t, Config{})
+	a, b, s := connect(t, hub, "a"), connect(t, hub, "b"), connect(t, hub, "s")
+	room := newRoom(t, a, b)
+	startGame(t, a, b)
+
+	joined := spectateRoom(t, s, room)
+	if !joined.Join || !joined.Spectator || len(joined.Players) != 2 {
+		t.Fatalf("got %+v", joined)
+	}
+	snapshot := GameSnapshot{}
+	s.expect(MessageTypeGameSnapshot, &snapshot)
+	if snapshot.GameState != GameStateCanRoll {
+		t.Errorf("got game state %d", snapshot.GameState)
+	}
+	spectator := SpectatorJoinedResponse{}
+	a.expect(MessageTypeSpectatorJoined, &spectator)
+	if spectator.ClientID != s.ID || spectator.Name != "s" {
+		t.Errorf("got %+v", spectator)
+	}
+
+	// spectators cannot play, whatever they send is handled before the
+	// snapshot they ask for next
+	s.send(MessageTypeBeginRoll, nil)
+	s.send(MessageTypeGameSnapshot, nil)
+	s.expect(MessageTypeGameSnapshot, &snapshot)
+	if snapshot.GameState != GameStateCanRoll || len(snapshot.Rolls) != 0 {
+		t.Errorf("the spectator rolled: %+v", snapshot)
+	}
+
+	// the moves go on without the spectator acknowledging them and the
+	// spectator sees the game end
+	for _, c := range []*testClient{a, b} {
+		if c.ID == snapshot.PlayerTurn {
+			c.send(MessageTypeBeginRoll, nil)
+		}
+	}
+	play(t, a, []*testClient{a, b}, is(MessageTypeEndGame))
+	s.expect(MessageTypeEndGame, nil)
+}
+
+func TestPromoteSpectator(t *testing.T) {
+	hub := newTestHub(t, Config{})
+	a, b, s := connect(t, hub, "a"), connect(t, hub, "b"), connect(t, hub, "s")
+	room := newRoom(t, a, b)
+	spectateRoom(t, s, room)
+
+	b.send(MessageTypePromoteSpectator, map[string]any{"spectator": s.ID})
+	resp := PromoteSpectatorResponse{}
+	b.expect(MessageTypePromoteSpectator, &resp)
+	if resp.ShouldPromote {
+		t.Error("a player who is not the master promoted a spectator")
+	}
+
+	a.send(MessageTypePromoteSpectator, map[string]any{"spectator": s.ID})
+	s.expect(MessageTypePromoteSpectator, &resp)
+	if !resp.ShouldPromote || resp.Player != s.ID || resp.Name != "s" {
+		t.Fatalf("got %+v", resp)
+	}
+
+	// the promoted spectator plays like everyone else
+	startGame(t, a, b, s)
+	a.send(MessageTypeGameSnapshot, nil)
+	snapshot := GameSnapshot{}
+	a.expect(MessageTypeGameSnapshot, &snapshot)
+	if len(snapshot.Players) != 3 {
+		t.Errorf("got players %+v", snapshot.Players)
+	}
+}
+
+func TestPromoteSpectatorDuringGame(t *testing.T) {
+	hub := newTestHub(t, Config{})
+	a, b, s := connect(t, hub, "a"), connect(t, hub, "b"), connect(t, hub, "s")
+	room := newRoom(t, a, b)
+	startGame(t, a, b)
+	spectateRoom(t, s, room)
+
+	a.send(MessageTypePromoteSpectator, map[string]any{"spectator": s.ID})
+	resp := PromoteSpectatorResponse{}
+	a.expect(MessageTypePromoteSpectator, &resp)
+	if resp.ShouldPromote {
+		t.Error("promoted a spectator during a game")
+	}
+}
+
+func TestRoomPassword(t *testing.T) {
+	hub := newTestHub(t, Config{})
+	a, b := connect(t, hub, "a"), connect(t, hub, "b")
+	a.send(MessageTypeCreateRoom, map[string]any{"name": "a", "password": "secret"})
+	created := CreateRoomResponse{}
+	a.expect(MessageTypeCreateRoom, &created)
+	a.waitRoom()
+
+	enter := func(password string) JoinRoomResponse {
+		b.send(MessageTypeEnterRoom, map[string]any{"room_id": created.RoomID, "name": "b", "password": password})
+		resp := JoinRoomResponse{}
+		b.expect(MessageTypeEnterRoom, &resp)
+		return resp
+	}
+	for _, password := range []string{"", "Secret", "secret2"} {
+		if resp := enter(password); resp.Join || resp.Reason != "wrong password" {
+			t.Errorf("%q: got %+v", password, resp)
+		}
+	}
+	resp := enter("secret")
+	if !resp.Join || !resp.Password {
+		t.Fatalf("got %+v", resp)
+	}
+	b.waitRoom()
+
+	b.send(MessageTypeSetPassword, map[string]any{"password": ""})
+	set := SetPasswordResponse{}
+	b.expect(MessageTypeSetPassword, &set)
+	if set.ShouldSet || !set.Password {
+		t.Errorf("a player who is not the master set the password: %+v", set)
+	}
+	a.send(MessageTypeSetPassword, map[string]any{"password": ""})
+	b.expect(MessageTypeSetPassword, &set)
+	if !set.ShouldSet || set.Password {
+		t.Errorf("got %+v", set)
+	}
+
+	c := connect(t, hub, "c")
+	c.send(MessageTypeEnterRoom, map[string]any{"room_id": created.RoomID, "name": "c"})
+	joined := JoinRoomResponse{}
+	c.expect(MessageTypeEnterRoom, &joined)
+	if !joined.Join || joined.Password {
+		t.Errorf("got %+v", joined)
+	}
+}
+
+func TestEnterRoomReasons(t *testing.T) {
+	hub := newTestHub(t, Config{})
+	clients := []*testClient{}
+	for idx := range MaxPlayerCountInRoom {
+		clients = append(clients, connect(t, hub, fmt.Sprint(idx)))
+	}
+	room := newRoom(t, clients...)
+	late := connect(t, hub, "late")
+	if resp := enterRoom(t, late, room); resp.Join || resp.Reason != "room is full" {
+		t.Errorf("got %+v", resp)
+	}
+
+	a, b := connect(t, hub, "a"), connect(t, hub, "b")
+	room = newRoom(t, a, b)
+	startGame(t, a, b)
+	if resp := enterRoom(t, late, room); resp.Join || resp.Reason != "game in progress" {
+		t.Errorf("got %+v", resp)
+	}
+	if resp := enterRoom(t, late, "nowhere"); resp.Join || resp.Reason != "room not found" {
+		t.Errorf("got %+v", resp)
+	}
+}
+
+func TestGameSnapshotAfterGame(t *testing.T) {
+	hub := newTestHub(t, Config{})
+	a, b, c := connect(t, hub, "a"), connect(t, hub, "b"), connect(t, hub, "c")
+	room := newRoom(t, a, b)
+	startGame(t, a, b)
+	play(t, a, []*testClient{a, b}, is(MessageTypeEndGame))
+
+	// the seats no longer match the state of the game that ended
+	enterRoom(t, c, room)
+	c.send(MessageTypeGameSnapshot, nil)
+	snapshot := GameSnapshot{}
+	c.expect(MessageTypeGameSnapshot, &snapshot)
+	if snapshot.GameState != GameStateGameEnded || len(snapshot.Players) != 3 || snapshot.Players[2].Name != "c" {
+		t.Errorf("got %+v", snapshot)
+	}
+}
+
+func TestKick(t *testing.T) {
+	hub := newTestHub(t, Config{})
+	a, b, c := connect(t, hub, "a"), connect(t, hub, "b"), connect(t, hub, "c")
+	room := newRoom(t, a, b, c)
+
+	// only the master kicks
+	b.send(MessageTypeKickPlayer, map[string]any{"player": c.ID})
+	b.sync()
+	a.send(MessageTypeGameSnapshot, nil)
+	snapshot := GameSnapshot{}
+	a.expect(MessageTypeGameSnapshot, &snapshot)
+	if len(snapshot.Players) != 3 {
+		t.Errorf("a player who is not the master kicked: %+v", snapshot.Players)
+	}
+
+	a.send(MessageTypeKickPlayer, map[string]any{"player": c.ID})
+	left := PlayerLeftResponse{}
+	b.expect(MessageTypePlayerLeft, &left)
+	if left.Player != c.ID || !left.Kicked {
+		t.Errorf("got %+v", left)
+	}
+
+	// a new master is picked whenever a player leaves
+	master := a
+	if left.Master == b.ID {
+		master = b
+	}
+	s := connect(t, hub, "s")
+	spectateRoom(t, s, room)
+	master.send(MessageTypeKickPlayer, map[string]any{"player": s.ID})
+	spectator := SpectatorLeftResponse{}
+	b.expect(MessageTypeSpectatorLeft, &spectator)
+	if spectator.Spectator != s.ID || !spectator.Kicked {
+		t.Errorf("got %+v", spectator)
+	}
+}
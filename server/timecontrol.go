@@ -0,0 +1,179 @@
+package main
+
+import (
+	"log"
+	"time"
+)
+
+const MaxTurnSeconds = 600
+const MaxBankSeconds = 3600
+const MaxIncrementSeconds = 60
+
+type TimeoutAction string
+
+const (
+	// TimeoutAuto throws for the player when rolling and plays the first
+	// legal move when selecting one.
+	TimeoutAuto    TimeoutAction = "auto"
+	TimeoutSkip    TimeoutAction = "skip"
+	TimeoutForfeit TimeoutAction = "forfeit"
+)
+
+// TimeControl limits how long a player takes to roll or to select a move.
+// Every decision gets TurnSeconds, the time used past them comes out of the
+// player's bank, and the bank grows by IncrementSeconds after each decision.
+// A zero TurnSeconds turns the timer off.
+type TimeControl struct {
+	TurnSeconds      int           `json:"turn_seconds"`
+	BankSeconds      int           `json:"bank_seconds"`
+	IncrementSeconds int           `json:"increment_seconds"`
+	TimeoutAction    TimeoutAction `json:"timeout_action"`
+}
+
+func (tc TimeControl) Clamped() TimeControl {
+	tc.TurnSeconds = min(max(tc.TurnSeconds, 0), MaxTurnSeconds)
+	tc.BankSeconds = min(max(tc.BankSeconds, 0), MaxBankSeconds)
+	tc.IncrementSeconds = min(max(tc.IncrementSeconds, 0), MaxIncrementSeconds)
+	switch tc.TimeoutAction {
+	case TimeoutAuto, TimeoutSkip, TimeoutForfeit:
+	default:
+		tc.TimeoutAction = TimeoutAuto
+	}
+	return tc
+}
+
+func (g *GameInstance) timerResponse() *TimerResponse {
+	if g.turnTimer == nil {
+		return nil
+	}
+	return &TimerResponse{
+		TurnSeconds:     g.TimeControl.TurnSeconds,
+		BankMillis:      g.CurrentPlayer().Bank.Milliseconds(),
+		RemainingMillis: time.Until(g.TurnDeadline).Milliseconds(),
+		Deadline:        g.TurnDeadline.UnixMilli(),
+		TimeoutAction:   g.timerAction,
+	}
+}
+
+// turnLimit is how long the current player has to act and what happens when
+// the time runs out, a client in bot mode gets the room's bot deadline when
+// it is shorter.
+func (g *GameInstance) turnLimit(r *Room) (time.Duration, TimeoutAction, bool) {
+	limit, ok := time.Duration(0), g.TimeControl.TurnSeconds != 0
+	if ok {
+		limit = time.Duration(g.TimeControl.TurnSeconds)*time.Second + g.CurrentPlayer().Bank
+	}
+	if g.CurrentPlayer().Client.BotMode() && r.BotDeadline > 0 && (!ok || r.BotDeadline < limit) {
+		return r.BotDeadline, TimeoutAuto, true
+	}
+	return limit, g.TimeControl.TimeoutAction, ok
+}
+
+// startTurnTimer starts the clock of the current player and returns its state
+// for the message that asks the player to act.
+func (g *GameInstance) startTurnTimer(r *Room) *TimerResponse {
+	g.stopTurnTimer()
+	limit, action, ok := g.turnLimit(r)
+	if !ok {
+		return nil
+	}
+	g.timerAction = action
+	g.TurnStarted = time.Now()
+	g.TurnDeadline = g.TurnStarted.Add(limit)
+	seq := g.timerSeq
+	g.turnTimer = time.AfterFunc(limit, func() {
+		r.TurnTimeout(seq)
+	})
+	return g.timerResponse()
+}
+
+// stopTurnTimer also invalidates a timeout that fired but did not reach the
+// room yet.
+func (g *GameInstance) stopTurnTimer() {
+	g.timerSeq++
+	if g.turnTimer != nil {
+		g.turnTimer.Stop()
+		g.turnTimer = nil
+	}
+}
+
+// chargeTurnTimer stops the clock of the current player once they acted.
+func (g *GameInstance) chargeTurnTimer() {
+	if g.turnTimer == nil {
+		return
+	}
+	g.stopTurnTimer()
+	if g.TimeControl.TurnSeconds == 0 {
+		return
+	}
+	player := g.CurrentPlayer()
+	over := time.Since(g.TurnStarted) - time.Duration(g.TimeControl.TurnSeconds)*time.Second
+	if over > 0 {
+		player.Bank = max(player.Bank-over, 0)
+	}
+	player.Bank += time.Duration(g.TimeControl.IncrementSeconds) * time.Second
+}
+
+func (g *GameInstance) TurnTimeout(r *Room, seq uint64) {
+	if seq != g.timerSeq || g.State == nil {
+		return
+	}
+	g.turnTimer = nil
+	player := g.CurrentPlayer()
+	player.Bank = 0
+	log.Printf("client '%s' ran out of time\n", player.Client.ID)
+	err := r.Broadcast(TurnTimeoutResponse{Player: player.Client.ID, Action: g.timerAction})
+	if err != nil {
+		log.Println(err)
+	}
+
+	switch g.timerAction {
+	case TimeoutSkip:
+		events, err := g.State.SkipTurn()
+		if err != nil {
+			log.Println(err)
+			return
+		}
+		g.BroadcastEvents(r, events)
+	case TimeoutForfeit:
+		// running out of time forfeits the seat the way leaving the game does,
+		// the player is taken out of the room
+		err := exit(r, player.Client.ID, true, LeaveForfeit)
+		if err != nil {
+			log.Println(err)
+		}
+	default:
+		switch g.GameState {
+		case GameStateCanRoll:
+			g.roll(r)
+		case GameStateSelectingMove:
+			if len(g.LegalMoves) == 0 {
+				return
+			}
+			m := g.LegalMoves[0]
+			path, err := g.State.CheckMove(m)
+			if err != nil {
+				log.Println(err)
+				return
+			}
+			g.beginMove(r, m, path)
+		}
+	}
+}
+
+type SetTimeControlGameAction struct {
+	TimeControl TimeControl
+}
+
+func (s SetTimeControlGameAction) Execute(c *Client, r *Room) {
+	instance := r.GameInstance
+	if instance.GameState != GameStateGameEnded || c != r.Master {
+		c.Send(SetTimeControlResponse{ShouldSet: false, TimeControl: instance.TimeControl})
+		return
+	}
+	instance.TimeControl = s.TimeControl
+	err := r.Broadcast(SetTimeControlResponse{ShouldSet: true, TimeControl: s.TimeControl})
+	if err != nil {
+		log.Println(err)
+	}
+}
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/AdventurerAmer/yutnori/rules"
+)
+
+func TestTimeControlClamped(t *testing.T) {
+	tests := []struct {
+		tc   TimeControl
+		want TimeControl
+	}{
+		{TimeControl{}, TimeControl{TimeoutAction: TimeoutAuto}},
+		{
+			TimeControl{TurnSeconds: -1, BankSeconds: -1, IncrementSeconds: -1, TimeoutAction: "nap"},
+			TimeControl{TimeoutAction: TimeoutAuto},
+		},
+		{
+			TimeControl{TurnSeconds: 1e6, BankSeconds: 1e6, IncrementSeconds: 1e6, TimeoutAction: TimeoutForfeit},
+			TimeControl{TurnSeconds: MaxTurnSeconds, BankSeconds: MaxBankSeconds, IncrementSeconds: MaxIncrementSeconds, TimeoutAction: TimeoutForfeit},
+		},
+		{
+			TimeControl{TurnSeconds: 30, BankSeconds: 60, IncrementSeconds: 5, TimeoutAction: TimeoutSkip},
+			TimeControl{TurnSeconds: 30, BankSeconds: 60, IncrementSeconds: 5, TimeoutAction: TimeoutSkip},
+		},
+	}
+	for _, test := range tests {
+		if got := test.tc.Clamped(); got != test.want {
+			t.Errorf("%+v: got %+v want %+v", test.tc, got, test.want)
+		}
+	}
+}
+
+func TestChargeTurnTimer(t *testing.T) {
+	g := &GameInstance{
+		State:       rules.NewState(2, 2),
+		Players:     []PlayerState{{Bank: 10 * time.Second}, {}},
+		TimeControl: TimeControl{TurnSeconds: 5, IncrementSeconds: 2},
+		turnTimer:   time.NewTimer(time.Hour),
+		TurnStarted: time.Now().Add(-8 * time.Second),
+	}
+	g.chargeTurnTimer()
+	// 3 seconds over the turn come out of the bank and 2 are added back
+	if bank := g.Players[0].Bank; bank > 9*time.Second || bank < 8*time.Second {
+		t.Errorf("got bank %v", bank)
+	}
+	if g.turnTimer != nil {
+		t.Error("the timer is still running")
+	}
+	g.chargeTurnTimer()
+	if bank := g.Players[0].Bank; bank > 9*time.Second {
+		t.Errorf("charged a stopped timer, got bank %v", bank)
+	}
+}
+
+func TestSetTimeControl(t *testing.T) {
+	hub := newTestHub(t, Config{})
+	a, b := connect(t, hub, "a"), connect(t, hub, "b")
+	room := newRoom(t, a, b)
+	tc := TimeControl{TurnSeconds: 30, BankSeconds: 60, IncrementSeconds: 5, TimeoutAction: TimeoutSkip}
+
+	b.send(MessageTypeSetTimeControl, tc)
+	resp := SetTimeControlResponse{}
+	b.expect(MessageTypeSetTimeControl, &resp)
+	if resp.ShouldSet {
+		t.Error("a player who is not the master set the time control")
+	}
+	a.send(MessageTypeSetTimeControl, map[string]any{"turn_seconds": 1e6, "timeout_action": "skip"})
+	b.expect(MessageTypeSetTimeControl, &resp)
+	if !resp.ShouldSet || resp.TimeControl != (TimeControl{TurnSeconds: MaxTurnSeconds, TimeoutAction: TimeoutSkip}) {
+		t.Errorf("got %+v", resp)
+	}
+	a.send(MessageTypeSetTimeControl, tc)
+	b.expect(MessageTypeSetTimeControl, &resp)
+
+	c := connect(t, hub, "c")
+	if joined := enterRoom(t, c, room); joined.TimeControl != tc {
+		t.Errorf("got %+v", joined.TimeControl)
+	}
+	startGame(t, a, b, c)
+	call := CallRollResponse{}
+	a.expect(MessageTypeCanRoll, &call)
+	if call.Timer == nil || call.Timer.TurnSeconds != 30 || call.Timer.BankMillis != 60000 || call.Timer.RemainingMillis <= 60000 {
+		t.Errorf("got timer %+v", call.Timer)
+	}
+}
+
+// timedGame starts a game where every decision times out after a second.
+func timedGame(t *testing.T, action TimeoutAction) (*testClient, *testClient, ClientID) {
+	t.Helper()
+	hub := newTestHub(t, Config{})
+	a, b := connect(t, hub, "a"), connect(t, hub, "b")
+	newRoom(t, a, b)
+	a.send(MessageTypeSetTimeControl, TimeControl{TurnSeconds: 1, TimeoutAction: action})
+	a.expect(MessageTypeSetTimeControl, nil)
+	return a, b, startGame(t, a, b)
+}
+
+func TestTurnTimeoutAuto(t *testing.T) {
+	a, _, first := timedGame(t, TimeoutAuto)
+	timeout := TurnTimeoutResponse{}
+	a.expect(MessageTypeTurnTimeout, &timeout)
+	if timeout.Player != first || timeout.Action != TimeoutAuto {
+		t.Errorf("got %+v", timeout)
+	}
+	// the server rolled for the player
+	a.expect(MessageTypeEndRoll, nil)
+}
+
+func TestTurnTimeoutSkip(t *testing.T) {
+	a, _, first := timedGame(t, TimeoutSkip)
+	timeout := TurnTimeoutResponse{}
+	a.expect(MessageTypeTurnTimeout, &timeout)
+	if timeout.Player != first || timeout.Action != TimeoutSkip {
+		t.Errorf("got %+v", timeout)
+	}
+	call := CallRollResponse{}
+	a.expect(MessageTypeCanRoll, &call)
+	if call.Player == first {
+		t.Error("the turn did not pass")
+	}
+}
+
+func TestTurnTimeoutForfeit(t *testing.T) {
+	a, b, first := timedGame(t, TimeoutForfeit)
+	late, other := a, b
+	if first == b.ID {
+		late, other = b, a
+	}
+	// the late player leaves the game as a forfeiting leaver does
+	left := PlayerLeftResponse{}
+	late.expect(MessageTypePlayerLeft, &left)
+	if left.Player != first || !left.Kicked || left.Master != other.ID {
+		t.Errorf("got %+v", left)
+	}
+	forfeited := PlayerForfeitedResponse{}
+	other.expect(MessageTypePlayerForfeited, &forfeited)
+	if forfeited.Player == first || !forfeited.TeamOut {
+		t.Errorf("got %+v", forfeited)
+	}
+	end := EndGameResponse{}
+	other.expect(MessageTypeEndGame, &end)
+	if end.Winner != other.ID {
+		t.Errorf("got winner %s want %s", end.Winner, other.ID)
+	}
+}